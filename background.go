@@ -0,0 +1,130 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultBackgroundInterval is the time between two background
+// measurements of a sensor without Interval. It is shorter than the
+// default load report interval of 40s of the execd.
+const DefaultBackgroundInterval = 30 * time.Second
+
+// WithBackgroundMeasurement decouples measuring from reporting: while
+// Run is executing, each sensor is measured in its own goroutine every
+// Interval of the sensor (DefaultBackgroundInterval when it has none)
+// and a load report only writes the latest result of each sensor, so
+// that it is written immediately even with slow sensors.
+//
+// The latest results are kept in memory, one per sensor, protected by
+// the mutex of the context. A sensor which was not measured yet when a
+// load report is requested is not part of it. When a background
+// measurement fails its error is logged once. The same error is only
+// logged again after the sensor succeeded or failed with a different
+// error in between. The sensor reports no value until its next
+// successful measurement, like a failing sensor in the default mode,
+// so a failing sensor never reports an outdated value. ReportOnChange,
+// the FailFast policy and the built-in values work as usual.
+// Parallelism is ignored since all sensors run concurrently.
+func WithBackgroundMeasurement() Option {
+	return func(ctx *Context) {
+		ctx.background = true
+	}
+}
+
+// startBackground starts the background measurement of all sensors.
+// The returned function stops all goroutines and waits until they
+// finished.
+func (ctx *Context) startBackground() func() {
+	c, cancel := context.WithCancel(context.Background())
+	ctx.mutex.Lock()
+	ctx.latest = make([]measurement, len(ctx.sensors))
+	ctx.mutex.Unlock()
+	var wg sync.WaitGroup
+	for i := range ctx.sensors {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx.measureBackground(c, i)
+		}(i)
+	}
+	return func() {
+		cancel()
+		wg.Wait()
+		ctx.mutex.Lock()
+		ctx.latest = nil
+		ctx.mutex.Unlock()
+	}
+}
+
+// measureBackground measures the sensor with the given index until c
+// is cancelled.
+func (ctx *Context) measureBackground(c context.Context, i int) {
+	sensor := ctx.sensors[i]
+	interval := sensor.Interval
+	if interval <= 0 {
+		interval = DefaultBackgroundInterval
+	}
+	// failure is the error of the previous measurement, a repeated
+	// error is not logged again
+	var failure string
+	for {
+		cycle := &cycleInfo{start: ctx.clock.Now()}
+		m := ctx.measureSensor(context.WithValue(c, cycleKey{}, cycle), sensor)
+		if c.Err() != nil {
+			return
+		}
+		ctx.logHostnameWarning()
+		var message string
+		if m.err != nil {
+			message = m.err.Error()
+		}
+		if message != failure {
+			ctx.logResult(i, m)
+		}
+		failure = message
+		ctx.mutex.Lock()
+		ctx.latest[i] = m
+		ctx.mutex.Unlock()
+		select {
+		case <-c.Done():
+			return
+		case <-ctx.clock.After(interval):
+		}
+	}
+}
+
+// latestResults returns the latest background measurements in sensor
+// order like measure. Each result is counted in the status of its
+// sensor once, later load reports get it as reused result. The errors
+// are already logged by the background measurement.
+func (ctx *Context) latestResults() ([]measurement, bool) {
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	results := append([]measurement(nil), ctx.latest...)
+	complete := true
+	for i := range ctx.latest {
+		if results[i].failed() && ctx.errorPolicy == FailFast {
+			complete = false
+		}
+		ctx.latest[i].reused = true
+	}
+	return results, complete
+}
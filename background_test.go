@@ -0,0 +1,57 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackgroundErrorLoggedOnce(t *testing.T) {
+	var calls atomic.Int32
+	s := testSensor("value", func() (string, error) {
+		if calls.Add(1) == 4 {
+			return "1", nil
+		}
+		return "", errors.New("broken")
+	})
+	s.Interval = 10 * time.Second
+	logs := &logRecorder{}
+	clock := NewFakeClock(testStart)
+	ctx, err := CreateWithOptions([]Sensor{s}, WithClock(clock), WithBackgroundMeasurement(),
+		WithErrorLogInterval(0), WithLogOutput(logs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := startExecd(t, ctx)
+	for i := 1; i < 5; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(s.Interval)
+	}
+	clock.BlockUntil(1)
+	if status := e.quit(); status != 0 {
+		t.Errorf("unexpected exit status %d", status)
+	}
+	if n := calls.Load(); n != 5 {
+		t.Fatalf("expected 5 measurements, got %d", n)
+	}
+	if n := logs.count("broken"); n != 2 {
+		t.Errorf("expected the error to be logged twice, got %d: %q", n, logs.logs.String())
+	}
+}
@@ -0,0 +1,179 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// powerSupplies is the directory of the power supplies exposed by the
+// kernel.
+const powerSupplies = "/sys/class/power_supply"
+
+// ErrNoPowerSupply is returned by the power source measurements when
+// the host exposes no matching power supply, which is the case for
+// most servers.
+var ErrNoPowerSupply = errors.New("no power supply found in " + powerSupplies)
+
+// Values reported by PowerSourceMeasurement.
+const (
+	PowerSourceAC      = "ac"
+	PowerSourceBattery = "battery"
+)
+
+// powerSupply is one entry of /sys/class/power_supply.
+type powerSupply struct {
+	dir  string
+	kind string
+}
+
+// readPowerSupplies returns the power supplies of the host.
+func readPowerSupplies() ([]powerSupply, error) {
+	if err := requireLinux(); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(powerSupplies)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoPowerSupply
+	}
+	if err != nil {
+		return nil, err
+	}
+	var supplies []powerSupply
+	for _, entry := range entries {
+		dir := filepath.Join(powerSupplies, entry.Name())
+		kind, err := readSysfsString(dir, "type")
+		if err != nil {
+			continue
+		}
+		supplies = append(supplies, powerSupply{dir: dir, kind: kind})
+	}
+	if len(supplies) == 0 {
+		return nil, ErrNoPowerSupply
+	}
+	return supplies, nil
+}
+
+// readSysfsString reads a single line attribute of a sysfs directory.
+func readSysfsString(dir, file string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// isBattery checks if a power supply is a battery or an UPS.
+func (s powerSupply) isBattery() bool {
+	return s.kind == "Battery" || s.kind == "UPS"
+}
+
+// PowerSourceMeasurement reports PowerSourceAC when the host is powered
+// by an external power supply (a mains or USB power supply which is
+// online) and PowerSourceBattery when it runs on a battery or an UPS
+// which is discharging, so that a RESTRING complex can be used to
+// drain hosts before they shut down. A host with batteries but without
+// mains power supply entry, like an UPS reporting through the kernel,
+// is on AC unless a battery is discharging. An error wrapping
+// ErrNoPowerSupply is returned when the host exposes no power supply
+// at all, so that no value is reported on typical servers. It is only
+// supported on Linux.
+func PowerSourceMeasurement() (string, error) {
+	supplies, err := readPowerSupplies()
+	if err != nil {
+		return "", err
+	}
+	onBattery, found := false, false
+	for _, s := range supplies {
+		switch {
+		case s.kind == "Mains" || strings.HasPrefix(s.kind, "USB"):
+			if online, err := readSysfsString(s.dir, "online"); err == nil {
+				found = true
+				if online == "1" {
+					return PowerSourceAC, nil
+				}
+			}
+		case s.isBattery():
+			if status, err := readSysfsString(s.dir, "status"); err == nil {
+				found = true
+				onBattery = onBattery || status == "Discharging"
+			}
+		}
+	}
+	if !found {
+		return "", ErrNoPowerSupply
+	}
+	if onBattery {
+		return PowerSourceBattery, nil
+	}
+	return PowerSourceAC, nil
+}
+
+// BatteryChargeMeasurement reports the charge level in percent of the
+// batteries and UPSs of the host (their capacity attribute), the
+// average when there are several. An error wrapping ErrNoPowerSupply
+// is returned when the host has no battery. It is only supported on
+// Linux.
+func BatteryChargeMeasurement() (string, error) {
+	supplies, err := readPowerSupplies()
+	if err != nil {
+		return "", err
+	}
+	total, count := 0, 0
+	var lastErr error
+	for _, s := range supplies {
+		if !s.isBattery() {
+			continue
+		}
+		capacity, err := readSysfsString(s.dir, "capacity")
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		percent, err := strconv.Atoi(capacity)
+		if err != nil {
+			lastErr = fmt.Errorf("invalid capacity in %s: %w", s.dir, err)
+			continue
+		}
+		total += percent
+		count++
+	}
+	if count == 0 {
+		if lastErr != nil {
+			return "", lastErr
+		}
+		return "", fmt.Errorf("%w: no battery", ErrNoPowerSupply)
+	}
+	return formatFloat(float64(total) / float64(count)), nil
+}
+
+// NewPowerSourceSensor creates a sensor reporting the power source of
+// the host (see PowerSourceMeasurement) as resource.
+func NewPowerSourceSensor(resource string) Sensor {
+	return NewSensor(resource, PowerSourceMeasurement)
+}
+
+// NewBatteryChargeSensor creates a sensor reporting the battery charge
+// in percent (see BatteryChargeMeasurement) as resource.
+func NewBatteryChargeSensor(resource string) Sensor {
+	return NewSensor(resource, BatteryChargeMeasurement)
+}
@@ -0,0 +1,97 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by a measurement function wrapped by
+// CircuitBreaker while the breaker is open. It is also wrapped by the
+// error of the failure which opened the breaker.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerOptions configures a CircuitBreaker.
+type BreakerOptions struct {
+	// Failures is the number of consecutive failures after which the
+	// breaker opens. The default is 5.
+	Failures int
+	// Cooldown is the time the breaker stays open before the
+	// measurement is tried again. The default is one minute.
+	Cooldown time.Duration
+}
+
+// breaker holds the state of a CircuitBreaker.
+type breaker struct {
+	sync.Mutex
+	clock     Clock
+	f         func() (string, error)
+	opts      BreakerOptions
+	failures  int
+	openUntil time.Time
+}
+
+func (b *breaker) measure() (string, error) {
+	b.Lock()
+	if !b.openUntil.IsZero() && b.clock.Now().Before(b.openUntil) {
+		until := b.openUntil
+		b.Unlock()
+		return "", fmt.Errorf("%w until %s", ErrCircuitOpen, until.Format(time.RFC3339))
+	}
+	b.Unlock()
+
+	value, err := b.f()
+
+	b.Lock()
+	defer b.Unlock()
+	if err == nil {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		return value, nil
+	}
+	b.failures++
+	// after the cooldown a single failure opens the breaker again
+	if b.failures >= b.opts.Failures || !b.openUntil.IsZero() {
+		b.openUntil = b.clock.Now().Add(b.opts.Cooldown)
+		return "", fmt.Errorf("%w (%w until %s)", err, ErrCircuitOpen, b.openUntil.Format(time.RFC3339))
+	}
+	return "", err
+}
+
+// CircuitBreaker returns a measurement function which stops calling f
+// for a cooldown period after it failed a configured number of times
+// in a row. While the breaker is open an error wrapping ErrCircuitOpen
+// is returned immediately, so that a broken backend (like a remote
+// service which runs into timeouts) does not slow down each load
+// report. The failure which opens the breaker is returned wrapping
+// ErrCircuitOpen as well. After the cooldown f is tried again: on
+// success the breaker closes, on failure it stays open for another
+// cooldown. Whether the breaker of a sensor is open is shown in its
+// SensorStatus.
+func CircuitBreaker(f func() (string, error), opts BreakerOptions) func() (string, error) {
+	if opts.Failures <= 0 {
+		opts.Failures = 5
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = time.Minute
+	}
+	b := &breaker{clock: currentClock(), f: f, opts: opts}
+	return b.measure
+}
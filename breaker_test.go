@@ -0,0 +1,64 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitOpenStatus(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	SetDefaultClock(clock)
+	t.Cleanup(func() { SetDefaultClock(nil) })
+	timeout := errors.New("timeout")
+	results := []error{timeout, timeout, nil, timeout, timeout, timeout, nil}
+	call := 0
+	measurement := CircuitBreaker(func() (string, error) {
+		err := results[call]
+		call++
+		return "1", err
+	}, BreakerOptions{Failures: 2, Cooldown: time.Minute})
+	ctx, err := CreateWithOptions([]Sensor{testSensor("value", measurement)}, WithClock(clock), WithLogOutput(&logRecorder{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		advance time.Duration
+		open    bool
+	}{
+		{0, false},           // first failure
+		{0, true},            // the second failure opens the breaker
+		{time.Second, true},  // rejected
+		{time.Minute, false}, // the trial succeeds
+		{0, false},           // first failure after closing
+		{0, true},            // the second failure opens the breaker
+		{time.Minute, true},  // the trial fails
+		{time.Minute, false}, // the trial succeeds
+	}
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		runReport(t, ctx)
+		if open := ctx.Status().Sensors[0].CircuitOpen; open != step.open {
+			t.Errorf("report %d: expected CircuitOpen %v, got %v", i+1, step.open, open)
+		}
+	}
+	if call != len(results) {
+		t.Errorf("expected %d measurements, got %d", len(results), call)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// WithCycleDurationResource reports the time the load sensor needed
+// for its previous load report (measuring all sensors and writing the
+// report) in seconds as the given resource of the local host. Since the
+// duration of the current load report is not known before it is
+// written, each report contains the duration of the one before; the
+// first report contains no value. This makes the overhead of the load
+// sensor visible in qhost next to the values it reports.
+func WithCycleDurationResource(resource string) Option {
+	return func(ctx *Context) {
+		ctx.cycleDurationResource = resource
+	}
+}
+
+// localHostname returns the host name used for values the context
+// reports itself. The name is determined by LocalHostname once and
+// cached after it was resolved successfully. Like for sensors an empty
+// result of the host transformation is an error.
+func (ctx *Context) localHostname() (string, error) {
+	ctx.mutex.Lock()
+	host := ctx.localHost
+	ctx.mutex.Unlock()
+	if host != "" {
+		return host, nil
+	}
+	host, err := LocalHostname()
+	if err != nil {
+		return "", err
+	}
+	if ctx.hostTransform != nil {
+		original := host
+		if host = ctx.hostTransform(host); host == "" {
+			return "", fmt.Errorf("host transformation returned an empty host name for %q", original)
+		}
+	}
+	ctx.mutex.Lock()
+	ctx.localHost = host
+	ctx.mutex.Unlock()
+	return host, nil
+}
+
+// WithHeartbeat reports the number of the current load report (the
+// first one is 1) as the given resource of the local host in every nth
+// load report, so that Grid Engine side monitoring can alert when the
+// value stops increasing. An every of 0 or less reports it in each load
+// report. The resource needs to be a complex in the Grid Engine
+// configuration like every other reported value. The counter restarts
+// at 1 when the load sensor is restarted.
+func WithHeartbeat(resource string, every int) Option {
+	return func(ctx *Context) {
+		if every < 1 {
+			every = 1
+		}
+		ctx.heartbeatResource, ctx.heartbeatEvery = resource, every
+	}
+}
+
+// builtinReports returns the values the context reports about itself
+// in the load report started at the given time.
+func (ctx *Context) builtinReports(start time.Time) []Report {
+	if ctx.cycleDurationResource == "" && ctx.heartbeatResource == "" && ctx.restartFile == "" {
+		return nil
+	}
+	ctx.mutex.Lock()
+	duration := ctx.lastCycleDuration
+	cycle := ctx.cycles + 1
+	restarts := ctx.restarts
+	ctx.mutex.Unlock()
+	var reports []Report
+	if ctx.cycleDurationResource != "" && duration != 0 {
+		reports = append(reports, Report{Resource: ctx.cycleDurationResource,
+			Value: formatFloat(duration.Seconds()), MeasuredAt: start})
+	}
+	if ctx.heartbeatResource != "" && (cycle-1)%uint64(ctx.heartbeatEvery) == 0 {
+		reports = append(reports, Report{Resource: ctx.heartbeatResource,
+			Value: strconv.FormatUint(cycle, 10), MeasuredAt: start})
+	}
+	if ctx.restartFile != "" && ctx.restartsResource != "" {
+		reports = append(reports, Report{Resource: ctx.restartsResource,
+			Value: strconv.FormatUint(restarts, 10), MeasuredAt: start})
+	}
+	if ctx.restartFile != "" && ctx.uptimeResource != "" {
+		reports = append(reports, Report{Resource: ctx.uptimeResource,
+			Value: strconv.FormatInt(int64(start.Sub(ctx.started)/time.Second), 10), MeasuredAt: start})
+	}
+	if len(reports) == 0 {
+		return nil
+	}
+	host, err := ctx.localHostname()
+	if err != nil {
+		ctx.logf("error during hostname function call: %s", err)
+		return nil
+	}
+	for i := range reports {
+		reports[i].Host = host
+	}
+	return reports
+}
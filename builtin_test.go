@@ -0,0 +1,46 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import "testing"
+
+func TestHeartbeatEmptyHostTransform(t *testing.T) {
+	t.Setenv("SGE_ROOT", "/opt/uge")
+	t.Setenv(ArchScriptEnv, "")
+	t.Setenv(HostnameBinaryEnv, "")
+	SetDefaultRunner(fakeGridEngine("lx-amd64", "node1"))
+	t.Cleanup(func() { SetDefaultRunner(nil) })
+	logs := &logRecorder{}
+	ctx, err := CreateWithOptions([]Sensor{
+		testSensor("value", func() (string, error) { return "1", nil }),
+	}, WithHeartbeat("heartbeat", 1), WithLogOutput(logs),
+		WithHostTransform(func(host string) string {
+			if host == "node1" {
+				return ""
+			}
+			return host
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report := runReport(t, ctx); report != "begin\nhost:value:1\nend\n" {
+		t.Errorf("unexpected report %q", report)
+	}
+	if n := logs.count(`host transformation returned an empty host name for "node1"`); n != 1 {
+		t.Errorf("expected the empty host name to be logged, got %q", logs.logs.String())
+	}
+}
@@ -0,0 +1,83 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ttlCache caches the successful result of a measurement function
+// for a given amount of time. Errors are not cached so that the
+// next call retries the measurement.
+type ttlCache struct {
+	sync.Mutex
+	clock      Clock
+	ttl        time.Duration
+	f          func() (string, error)
+	value      string
+	measuredAt time.Time
+	expires    time.Time
+	valid      bool
+}
+
+// cached wraps the measurement function f so that it is executed
+// at most once per ttl. A negative ttl caches the first successful
+// result forever. When a cached value is returned during a load
+// report the time it was originally measured is reported as its
+// MeasuredAt time.
+func cached(f func() (string, error), ttl time.Duration) func(context.Context) (string, error) {
+	c := &ttlCache{clock: currentClock(), ttl: ttl, f: f}
+	return c.get
+}
+
+// newCachedSensor creates a sensor for the local host reporting the
+// result of f as resource, which is measured at most once per ttl.
+func newCachedSensor(resource string, f func() (string, error), ttl time.Duration) Sensor {
+	sensor := NewSensor(resource, nil)
+	sensor.MeasurementContextFunction = cached(f, ttl)
+	return sensor
+}
+
+// NewStaticSensor creates a sensor for the local host reporting a
+// value which does not change during the runtime of the load sensor,
+// like the number of cores or the installed memory. The measurement
+// function f is executed in the first load report only and its value
+// is reported again in each following load report, since Grid Engine
+// drops values which are missing from a load report. When f fails it
+// is executed again in the next load report until it succeeds once.
+func NewStaticSensor(resource string, f func() (string, error)) Sensor {
+	return newCachedSensor(resource, f, -1)
+}
+
+func (c *ttlCache) get(ctx context.Context) (string, error) {
+	c.Lock()
+	defer c.Unlock()
+	now := c.clock.Now()
+	if c.valid && (c.ttl < 0 || now.Before(c.expires)) {
+		setMeasuredAt(ctx, c.measuredAt)
+		return c.value, nil
+	}
+	value, err := c.f()
+	if err != nil {
+		c.valid = false
+		return "", err
+	}
+	c.value, c.measuredAt, c.expires, c.valid = value, now, now.Add(c.ttl), true
+	return value, nil
+}
@@ -0,0 +1,89 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import "time"
+
+// catchUpCheckInterval is the time between two checks for a gap in
+// the load reports.
+const catchUpCheckInterval = time.Second
+
+// WithCatchUp writes a load report without trigger when no load report
+// was written for longer than interval, which should be the load
+// report interval of the execd (load_report_time, 40s by default) or a
+// multiple of it. This covers a load sensor which was paused, for
+// example by a suspended virtual machine or a long stall, and missed
+// the triggers of the execd, so that the report sinks and hooks (see
+// WithReportSink) do not miss the time of the gap and the next request
+// of the execd is answered with current values without waiting for
+// the measurements.
+//
+// The execd reads one load report per request, so a catch-up report
+// waits in the output until the next request arrives and answers it
+// like the startup report of WithEmitOnStartup: no further load report
+// is written for that request, otherwise the execd would read every
+// following load report one request late. Grid Engine therefore only
+// receives the catch-up report with the next request.
+//
+// A gap is detected by comparing the wall clock time since the last
+// load report with interval once per second, so time the host was
+// suspended counts as well. The catch-up report contains the current
+// values of the sensors, values of the missed load reports are not
+// reported. After a catch-up report no further one is written until
+// the execd requested load reports again, so a load sensor whose
+// execd stopped sending triggers does not keep writing reports. The
+// first load report is never a catch-up report. An interval of 0
+// (the default) disables catch-up reports.
+func WithCatchUp(interval time.Duration) Option {
+	return func(ctx *Context) {
+		ctx.catchUp = interval
+	}
+}
+
+// watchGaps requests a catch-up load report through catchUps when the
+// time since the last load report exceeds the catch-up interval. It
+// returns when done is closed.
+func (ctx *Context) watchGaps(catchUps chan<- struct{}, done <-chan struct{}) {
+	armed := true
+	var firedCycles uint64
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.clock.After(catchUpCheckInterval):
+		}
+		ctx.mutex.Lock()
+		last, cycles := ctx.lastCycle, ctx.cycles
+		ctx.mutex.Unlock()
+		if !armed && cycles > firedCycles+1 {
+			// the execd triggered a load report after the catch-up
+			armed = true
+		}
+		// Round(0) strips the monotonic clock reading, which does not
+		// advance while the host is suspended
+		if !armed || last.IsZero() || ctx.clock.Now().Round(0).Sub(last.Round(0)) <= ctx.catchUp {
+			continue
+		}
+		select {
+		case catchUps <- struct{}{}:
+			ctx.logf("no load report for more than %s, writing a catch-up report", ctx.catchUp)
+		default:
+			// a catch-up report is already pending
+		}
+		armed, firedCycles = false, cycles
+	}
+}
@@ -0,0 +1,207 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupRoot is the mount point of the cgroup file systems.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// ErrNoCgroup is returned by the cgroup measurements when neither
+// cgroup v1 nor cgroup v2 is available.
+var ErrNoCgroup = errors.New("no cgroup v1 or v2 file system found")
+
+// cgroupVersion returns 2 for a unified cgroup v2 hierarchy, 1 for
+// cgroup v1 and an error when cgroups are not available.
+func cgroupVersion() (int, error) {
+	if err := requireLinux(); err != nil {
+		return 0, err
+	}
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err == nil {
+		return 2, nil
+	}
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "memory")); err == nil {
+		return 1, nil
+	}
+	return 0, ErrNoCgroup
+}
+
+// cgroupDir returns the directory of the cgroup of the current process
+// for the given cgroup v1 controller or, when controller is empty, for
+// the cgroup v2 hierarchy. Inside of a container the cgroup path of
+// /proc/self/cgroup is often not visible, in that case the root of the
+// hierarchy (the cgroup of the container) is used.
+func cgroupDir(controller string) (string, error) {
+	content, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	mount := cgroupRoot
+	if controller != "" {
+		mount = filepath.Join(cgroupRoot, controller)
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		matches := false
+		if controller == "" {
+			matches = fields[0] == "0" && fields[1] == ""
+		} else {
+			for _, c := range strings.Split(fields[1], ",") {
+				matches = matches || c == controller
+			}
+		}
+		if !matches {
+			continue
+		}
+		dir := filepath.Join(mount, fields[2])
+		if _, err := os.Stat(dir); err == nil {
+			return dir, nil
+		}
+		return mount, nil
+	}
+	return mount, nil
+}
+
+// readCgroupValue reads a single value file of a cgroup. The value
+// "max" (no limit) is returned as -1.
+func readCgroupValue(dir, file string) (int64, error) {
+	content, err := os.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(content))
+	if value == "max" {
+		return -1, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// CgroupMemoryFreeMeasurement reports the memory in bytes which is
+// still available to the cgroup the load sensor is running in: the
+// memory limit (memory.max in cgroup v2, memory.limit_in_bytes in
+// cgroup v1) minus the current usage. When the cgroup has no memory
+// limit the available memory of the host (MemAvailable in
+// /proc/meminfo) is reported. An error wrapping ErrNoCgroup is returned
+// when no cgroup file system is found.
+func CgroupMemoryFreeMeasurement() (string, error) {
+	version, err := cgroupVersion()
+	if err != nil {
+		return "", err
+	}
+	limitFile, usageFile, controller := "memory.max", "memory.current", ""
+	if version == 1 {
+		limitFile, usageFile, controller = "memory.limit_in_bytes", "memory.usage_in_bytes", "memory"
+	}
+	dir, err := cgroupDir(controller)
+	if err != nil {
+		return "", err
+	}
+	limit, err := readCgroupValue(dir, limitFile)
+	if err != nil {
+		return "", fmt.Errorf("can not read cgroup memory limit: %w", err)
+	}
+	usage, err := readCgroupValue(dir, usageFile)
+	if err != nil {
+		return "", fmt.Errorf("can not read cgroup memory usage: %w", err)
+	}
+	meminfo, err := readMeminfo()
+	if err != nil {
+		return "", err
+	}
+	available, found := meminfo["MemAvailable"]
+	// cgroup v1 reports a huge number when there is no limit
+	if limit < 0 || (found && uint64(limit) >= meminfo["MemTotal"]) {
+		if !found {
+			return "", errors.New("no MemAvailable in /proc/meminfo")
+		}
+		return strconv.FormatUint(available, 10), nil
+	}
+	free := limit - usage
+	if free < 0 {
+		free = 0
+	}
+	if found && uint64(free) > available {
+		free = int64(available)
+	}
+	return strconv.FormatInt(free, 10), nil
+}
+
+// CgroupCPUUsageMeasurement reports the CPU time in seconds consumed
+// by all processes of the cgroup the load sensor is running in since
+// the cgroup was created (usage_usec of cpu.stat in cgroup v2,
+// cpuacct.usage in cgroup v1). The value is a cumulative counter, a
+// usage rate is derived by comparing two measurements. An error
+// wrapping ErrNoCgroup is returned when no cgroup file system is found.
+func CgroupCPUUsageMeasurement() (string, error) {
+	version, err := cgroupVersion()
+	if err != nil {
+		return "", err
+	}
+	if version == 1 {
+		dir, err := cgroupDir("cpuacct")
+		if err != nil {
+			return "", err
+		}
+		nanoseconds, err := readCgroupValue(dir, "cpuacct.usage")
+		if err != nil {
+			return "", fmt.Errorf("can not read cgroup CPU usage: %w", err)
+		}
+		return formatFloat(float64(nanoseconds) / 1e9), nil
+	}
+	dir, err := cgroupDir("")
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return "", fmt.Errorf("can not read cgroup CPU usage: %w", err)
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "usage_usec" {
+			microseconds, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return "", fmt.Errorf("invalid usage_usec in cpu.stat: %w", err)
+			}
+			return formatFloat(float64(microseconds) / 1e6), nil
+		}
+	}
+	return "", errors.New("no usage_usec in cpu.stat")
+}
+
+// NewCgroupMemoryFreeSensor creates a sensor reporting the memory
+// available to the cgroup of the load sensor in bytes as resource.
+func NewCgroupMemoryFreeSensor(resource string) Sensor {
+	return NewSensor(resource, CgroupMemoryFreeMeasurement)
+}
+
+// NewCgroupCPUUsageSensor creates a sensor reporting the cumulative
+// CPU seconds of the cgroup of the load sensor as resource.
+func NewCgroupCPUUsageSensor(resource string) Sensor {
+	return NewSensor(resource, CgroupCPUUsageMeasurement)
+}
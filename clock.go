@@ -0,0 +1,166 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for all time dependent functionality
+// of the package. It can be replaced (see WithClock and
+// SetDefaultClock) in order to test time dependent sensors without
+// waiting for real time to pass. All waiting of the package goes
+// through the Sleep and After methods of the clock: the retries of
+// WaitForHostname and of the EOF grace period, the two samples of
+// rate measurements like IOWaitMeasurement and PowerDrawMeasurement,
+// Debounce, background measurements and catch-up reports. With a
+// FakeClock they wait until the test advances the clock far enough
+// instead of waiting for real time to pass. Only network and command
+// timeouts, like the ones of the health checks, the snmp package and
+// HostnameTimeout, are deadlines of the operating system and always
+// use real time.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// Sleep pauses the calling goroutine for the given duration.
+	Sleep(d time.Duration)
+	// After returns a channel which receives the current time after
+	// the given duration.
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock implements Clock using the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+var (
+	clockMutex   sync.Mutex
+	defaultClock Clock = realClock{}
+)
+
+// SetDefaultClock replaces the clock used by all time dependent
+// measurement wrappers and contexts created afterwards. Passing nil
+// restores the real clock.
+func SetDefaultClock(c Clock) {
+	clockMutex.Lock()
+	defer clockMutex.Unlock()
+	if c == nil {
+		c = realClock{}
+	}
+	defaultClock = c
+}
+
+// currentClock returns the clock set by SetDefaultClock.
+func currentClock() Clock {
+	clockMutex.Lock()
+	defer clockMutex.Unlock()
+	return defaultClock
+}
+
+// FakeClock is a Clock for tests. Its time only moves forward when
+// Advance is called. Sleep and the channels returned by After wait
+// until Advance moved the time to their deadline, a test therefore
+// advances the clock from another goroutine than the one waiting on
+// it (see BlockUntil).
+type FakeClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+	cond    *sync.Cond
+}
+
+// fakeWaiter is a channel returned by FakeClock.After which did not
+// fire yet.
+type fakeWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewFakeClock creates a FakeClock starting at the given time.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now returns the current time of the fake clock.
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Advance moves the time of the fake clock forward by d and wakes up
+// all waiters whose deadline was reached.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	waiting := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.deadline.After(c.now) {
+			waiting = append(waiting, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = waiting
+}
+
+// Sleep blocks until Advance moved the fake clock forward by d.
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// After returns a channel which receives the time of the fake clock
+// as soon as Advance moved it forward by d. A duration which is not
+// positive fires immediately.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{deadline: c.now.Add(d), ch: ch})
+	c.signal().Broadcast()
+	return ch
+}
+
+// BlockUntil blocks until at least n goroutines wait on the fake clock
+// with Sleep or After, so that a test can advance the clock after the
+// code under test started waiting. Channels of After which are not
+// received from anymore count as waiting until their deadline passed.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for len(c.waiters) < n {
+		c.signal().Wait()
+	}
+}
+
+// signal returns the condition signalled when a waiter is added. It
+// must be called with the mutex held.
+func (c *FakeClock) signal() *sync.Cond {
+	if c.cond == nil {
+		c.cond = sync.NewCond(&c.mutex)
+	}
+	return c.cond
+}
@@ -0,0 +1,122 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeClockAfter(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	ch := clock.After(10 * time.Second)
+	clock.Advance(9 * time.Second)
+	select {
+	case <-ch:
+		t.Fatal("fired before the deadline")
+	default:
+	}
+	clock.Advance(time.Second)
+	select {
+	case now := <-ch:
+		if !now.Equal(testStart.Add(10 * time.Second)) {
+			t.Errorf("unexpected time %s", now)
+		}
+	default:
+		t.Fatal("did not fire at the deadline")
+	}
+	if now := clock.Now(); !now.Equal(testStart.Add(10 * time.Second)) {
+		t.Errorf("After moved the clock to %s", now)
+	}
+}
+
+func TestFakeClockSleep(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	done := make(chan struct{})
+	go func() {
+		clock.Sleep(time.Minute)
+		close(done)
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Sleep did not return after Advance")
+	}
+}
+
+func TestWaitForHostnameBackoff(t *testing.T) {
+	t.Setenv("SGE_ROOT", "")
+	clock := NewFakeClock(testStart)
+	type result struct {
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		_, err := waitForHostname(clock, 10*time.Second)
+		done <- result{err}
+	}()
+	// the backoff doubles from one second on: the attempts happen at
+	// 0s, 1s, 3s and 7s, the next one would exceed the timeout
+	for _, backoff := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		clock.BlockUntil(1)
+		clock.Advance(backoff)
+	}
+	var r result
+	select {
+	case r = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("waitForHostname did not return")
+	}
+	var startupErr *StartupError
+	if !errors.As(r.err, &startupErr) {
+		t.Fatalf("expected a StartupError, got %v", r.err)
+	}
+	if startupErr.Attempts != 4 || startupErr.Elapsed != 7*time.Second {
+		t.Errorf("expected 4 attempts in 7s, got %d in %s", startupErr.Attempts, startupErr.Elapsed)
+	}
+	if !errors.Is(r.err, ErrSGERootUnset) {
+		t.Errorf("expected the error of the last attempt, got %v", r.err)
+	}
+}
+
+func TestIntervalWithClock(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	calls := 0
+	s := testSensor("value", func() (string, error) {
+		calls++
+		return "1", nil
+	})
+	s.Interval = time.Minute
+	ctx, err := CreateWithOptions([]Sensor{s}, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range []time.Duration{0, 30 * time.Second, 29 * time.Second, time.Second} {
+		clock.Advance(step)
+		if report := runReport(t, ctx); report != "begin\nhost:value:1\nend\n" {
+			t.Errorf("unexpected report %q", report)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 measurements within the interval, got %d", calls)
+	}
+}
@@ -0,0 +1,94 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// maxCommandLength is the maximum length of a line read from the
+// execd. Longer lines are no commands and are ignored.
+const maxCommandLength = 4096
+
+// command is a command sent by the execd to the load sensor.
+type command int
+
+const (
+	// commandTrigger requests a load report.
+	commandTrigger command = iota
+	// commandQuit requests the load sensor to terminate.
+	commandQuit
+	// commandIgnore is input which is not a command, like binary
+	// data on a misconnected pipe.
+	commandIgnore
+)
+
+// parseCommand classifies a line read from the execd. The execd sends
+// an empty line when it wants a load report and "quit" on shutdown.
+// Since not all Grid Engine versions send exactly an empty line, the
+// line is trimmed and everything except "quit" requests a load report:
+// an empty line, a line containing only whitespace (including a
+// trailing "\r" of CRLF input) and any other text. Lines longer than
+// maxCommandLength and lines containing control characters other than
+// whitespace are ignored.
+func parseCommand(line string) command {
+	if len(line) > maxCommandLength {
+		return commandIgnore
+	}
+	for _, r := range line {
+		if r == unicode.ReplacementChar || (unicode.IsControl(r) && !unicode.IsSpace(r)) {
+			return commandIgnore
+		}
+	}
+	if strings.TrimSpace(line) == "quit" {
+		return commandQuit
+	}
+	return commandTrigger
+}
+
+// readCommand reads the next line from the execd and classifies it
+// (see parseCommand). Lines which do not fit into the buffer of r are
+// read completely, but at most maxCommandLength+1 bytes are kept so
+// that huge lines do not exhaust the memory. A last line without
+// newline is classified like any other line. The error of the
+// underlying reader (io.EOF when stdin was closed) is returned as is.
+func readCommand(r *bufio.Reader) (command, error) {
+	var line []byte
+	for {
+		fragment, isPrefix, err := r.ReadLine()
+		if err != nil && len(line) > 0 && errors.Is(err, io.EOF) {
+			// the last line of the input has no newline
+			return parseCommand(string(line)), nil
+		}
+		if err != nil {
+			return commandIgnore, err
+		}
+		if room := maxCommandLength + 1 - len(line); room > 0 {
+			if len(fragment) > room {
+				fragment = fragment[:room]
+			}
+			line = append(line, fragment...)
+		}
+		if !isPrefix {
+			return parseCommand(string(line)), nil
+		}
+	}
+}
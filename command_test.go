@@ -0,0 +1,105 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// readAll returns all commands read from data with a small buffer,
+// so that long lines are read in several fragments.
+func readAll(t *testing.T, data []byte) []command {
+	t.Helper()
+	r := bufio.NewReaderSize(bytes.NewReader(data), 16)
+	var commands []command
+	for {
+		cmd, err := readCommand(r)
+		if errors.Is(err, io.EOF) {
+			return commands
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		commands = append(commands, cmd)
+	}
+}
+
+func FuzzReadCommand(f *testing.F) {
+	for _, seed := range []string{
+		"\n", "quit\n", "\r\n", "quit\r\n", " quit \n", "\n\nquit\n",
+		"partial", "\x00\x01\xff\n", strings.Repeat("x", maxCommandLength+10) + "\nquit\n",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		commands := readAll(t, data)
+		lines := strings.Split(string(data), "\n")
+		if lines[len(lines)-1] == "" {
+			// no line after the last newline
+			lines = lines[:len(lines)-1]
+		}
+		if len(commands) != len(lines) {
+			t.Fatalf("read %d commands from %d lines", len(commands), len(lines))
+		}
+		for i, line := range lines {
+			expected := parseCommand(strings.TrimSuffix(line, "\r"))
+			if i == len(lines)-1 && !bytes.HasSuffix(data, []byte("\n")) {
+				// a "\r" is only removed in front of a newline
+				expected = parseCommand(line)
+			}
+			if commands[i] != expected {
+				t.Errorf("line %d %q: expected command %d, got %d", i, line, expected, commands[i])
+			}
+		}
+	})
+}
+
+func TestReadCommandLongLine(t *testing.T) {
+	data := strings.Repeat("x", 10*maxCommandLength) + "\r\nquit\r\n"
+	commands := readAll(t, []byte(data))
+	if len(commands) != 2 || commands[0] != commandIgnore || commands[1] != commandQuit {
+		t.Errorf("unexpected commands %v", commands)
+	}
+}
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected command
+	}{
+		{"", commandTrigger},
+		{" \t", commandTrigger},
+		{"\r", commandTrigger},
+		{"report", commandTrigger},
+		{"quit", commandQuit},
+		{" quit\r", commandQuit},
+		{"QUIT", commandTrigger},
+		{"quit now", commandTrigger},
+		{"\x00", commandIgnore},
+		{"\xff\xfe", commandIgnore},
+		{strings.Repeat(" ", maxCommandLength+1), commandIgnore},
+	}
+	for _, test := range tests {
+		if cmd := parseCommand(test.line); cmd != test.expected {
+			t.Errorf("parseCommand(%q): expected %d, got %d", test.line, test.expected, cmd)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// parseComplexes returns the names of the complexes in the output of
+// qconf -sc. Each complex is one line starting with its name followed
+// by its shortcut, type and further attributes. Comment lines start
+// with #.
+func parseComplexes(output string) map[string]bool {
+	complexes := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		complexes[fields[0]] = true
+	}
+	return complexes
+}
+
+// builtinResources returns the resources of the values the context
+// reports about itself.
+func (ctx *Context) builtinResources() []string {
+	var resources []string
+	for _, resource := range []string{ctx.cycleDurationResource, ctx.heartbeatResource} {
+		if resource != "" {
+			resources = append(resources, resource)
+		}
+	}
+	if ctx.restartFile != "" {
+		for _, resource := range []string{ctx.restartsResource, ctx.uptimeResource} {
+			if resource != "" {
+				resources = append(resources, resource)
+			}
+		}
+	}
+	return resources
+}
+
+// VerifyComplexes checks that each resource the context reports is a
+// complex of the Grid Engine cluster, since the qmaster silently drops
+// load values of unknown complexes. It executes qconf -sc of the
+// installation in SGE_ROOT ($SGE_ROOT/bin/<arch>/qconf, see Arch) and
+// returns the resources (see Resources and the values the context
+// reports about itself, like WithHeartbeat and WithErrorComplexes)
+// which are not defined as complex. When qconf can not be executed,
+// for example on a host which is not an admin host, no resources are
+// returned and the error tells why. Errors of ResourceNameFunctions
+// are returned together with the undefined resources of the other
+// sensors.
+func VerifyComplexes(ctx *Context) ([]string, error) {
+	d := defaultDetector()
+	arch, err := d.Arch()
+	if err != nil {
+		return nil, fmt.Errorf("can not verify complexes: %w", err)
+	}
+	out, err := runCommandWith(d.runner, filepath.Join(d.root, "bin", arch, "qconf"), "-sc")
+	if err != nil {
+		return nil, fmt.Errorf("can not verify complexes: %w", err)
+	}
+	complexes := parseComplexes(out)
+	if len(complexes) == 0 {
+		return nil, errors.New("can not verify complexes: qconf -sc returned no complexes")
+	}
+	resources, errResources := ctx.Resources()
+	if ctx.errorSuffix != "" {
+		for _, resource := range resources {
+			resources = append(resources, resource+ctx.errorSuffix)
+		}
+	}
+	resources = append(resources, ctx.builtinResources()...)
+	var undefined []string
+	seen := make(map[string]bool)
+	for _, resource := range resources {
+		if !complexes[resource] && !seen[resource] {
+			undefined = append(undefined, resource)
+		}
+		seen[resource] = true
+	}
+	return undefined, errResources
+}
@@ -0,0 +1,89 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseSensorConfig reads a sensor configuration file and creates its
+// sensors. Each line is a sensor specification in the format of
+// ParseSensorFlag, empty lines and lines starting with # are ignored:
+//
+//	# scratch space in MiB
+//	scratch_free=/usr/local/bin/scratch-free --mb
+//	gpu_temp=/usr/bin/nvidia-smi --query-gpu=temperature.gpu --format=csv,noheader
+//
+// Unlike on the command line the specifications are not quoted as a
+// whole. All invalid lines are returned in one error.
+func ParseSensorConfig(r io.Reader) ([]Sensor, error) {
+	var sensors []Sensor
+	var errs []error
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		spec := strings.TrimSpace(scanner.Text())
+		if spec == "" || strings.HasPrefix(spec, "#") {
+			continue
+		}
+		sensor, err := ParseSensorFlag(spec)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", line, err))
+			continue
+		}
+		sensors = append(sensors, sensor)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sensors, errors.Join(errs...)
+}
+
+// ExportConfig writes the sensors of the context which were created
+// from a specification (see ParseSensorFlag and ParseSensorConfig) in
+// the format read by ParseSensorConfig, so that the configuration of
+// a running load sensor can be kept under version control. Only the
+// specification is written: settings changed afterwards, like the
+// Interval of a sensor, are not part of the file. Sensors implemented
+// by functions can not be written and are listed as comments instead.
+func (ctx *Context) ExportConfig(w io.Writer) error {
+	ctx.mutex.Lock()
+	sensors := ctx.sensors
+	ctx.mutex.Unlock()
+	var buf strings.Builder
+	buf.WriteString("# load sensor configuration, one resource=command per line\n")
+	for i, sensor := range sensors {
+		if sensor.spec != "" {
+			buf.WriteString(sensor.spec + "\n")
+			continue
+		}
+		name := "multi-host sensor"
+		if sensor.ResourceNameFunction != nil {
+			resource, err := sensor.ResourceNameFunction()
+			if err != nil {
+				resource = "unknown resource"
+			}
+			name = resource
+		}
+		fmt.Fprintf(&buf, "# sensor %d (%s) is implemented by a function and can not be exported\n", i, name)
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
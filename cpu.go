@@ -0,0 +1,59 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// procStatValue returns the value of a single value line of
+// /proc/stat like "procs_running 3".
+func procStatValue(content []byte, key string) (uint64, error) {
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == key {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("no %s in /proc/stat", key)
+}
+
+// RunQueueMeasurement reports the procs_running value of /proc/stat:
+// the number of tasks which are currently running on a CPU or are
+// runnable and waiting for a CPU (the load sensor itself included).
+// Tasks blocked on I/O are not counted. Unlike the load average it is
+// an instantaneous value and reacts immediately to changes. It is only
+// supported on Linux.
+func RunQueueMeasurement() (string, error) {
+	content, err := readProcFile("/proc/stat")
+	if err != nil {
+		return "", err
+	}
+	running, err := procStatValue(content, "procs_running")
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(running, 10), nil
+}
+
+// NewRunQueueSensor creates a sensor reporting the number of runnable
+// tasks (see RunQueueMeasurement) as resource.
+func NewRunQueueSensor(resource string) Sensor {
+	return NewSensor(resource, RunQueueMeasurement)
+}
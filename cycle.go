@@ -0,0 +1,497 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrorPolicy defines how a cycle continues when a sensor fails.
+//
+// With ContinueOnError (the default) a failing sensor is logged and
+// skipped while all other sensors are reported as usual.
+//
+// With FailFast the first failing sensor aborts the whole cycle and
+// the report of that cycle contains no values (only the begin and
+// end lines). A sensor with a ReportsFunction which dropped only some
+// of its values does not abort the cycle (see Sensor.ReportsFunction).
+// When sensors are executed in parallel (see
+// WithParallelism) the context passed to each
+// MeasurementContextFunction is cancelled as soon as one sensor
+// fails, so that still running measurements can return early.
+// Sensors which have not been started yet are not executed anymore.
+// Sensors using a MeasurementFunction (or a MeasurementContextFunction
+// ignoring the context) can not be interrupted: they run until they
+// finish but their results are discarded. The cycle therefore takes
+// as long as the slowest measurement which was already running.
+type ErrorPolicy int
+
+const (
+	// ContinueOnError skips failing sensors and reports all others.
+	ContinueOnError ErrorPolicy = iota
+	// FailFast reports no values at all when a sensor fails.
+	FailFast
+)
+
+// WithErrorPolicy sets how the context handles failing sensors.
+// The default is ContinueOnError.
+func WithErrorPolicy(p ErrorPolicy) Option {
+	return func(ctx *Context) {
+		ctx.errorPolicy = p
+	}
+}
+
+// WithParallelism sets how many sensors are measured concurrently
+// in one cycle. The default of 1 measures all sensors sequentially
+// in the order they were given. Independent of the parallelism the
+// values are always reported in the order of the sensors.
+func WithParallelism(n int) Option {
+	return func(ctx *Context) {
+		if n < 1 {
+			n = 1
+		}
+		ctx.parallelism = n
+	}
+}
+
+// measurement is the outcome of one sensor in a cycle.
+type measurement struct {
+	ran        bool
+	skipped    bool
+	reused     bool
+	cleared    bool
+	host       string
+	resource   string
+	value      string
+	measuredAt time.Time
+	err        error
+	// reports are the values of a sensor with a ReportsFunction
+	reports []Report
+}
+
+// failed checks if the measurement failed. A sensor with a
+// ReportsFunction which returned valid values together with an error
+// only failed partially, its valid values are reported even with
+// FailFast.
+func (m measurement) failed() bool {
+	return m.err != nil && len(m.reports) == 0
+}
+
+// callKey is the context key under which the callInfo of the
+// current measurement is stored.
+type callKey struct{}
+
+// callInfo allows measurement functions to pass information about a
+// value back to the cycle.
+type callInfo struct {
+	measuredAt time.Time
+}
+
+// setMeasuredAt overrides the MeasuredAt time of the value returned
+// by the current measurement, for example when a cached value is
+// returned.
+func setMeasuredAt(c context.Context, t time.Time) {
+	if c == nil {
+		return
+	}
+	if info, ok := c.Value(callKey{}).(*callInfo); ok {
+		info.measuredAt = t
+	}
+}
+
+// hostAllowed checks the local host name against the HostAllowlist
+// of the sensor.
+func hostAllowed(c context.Context, allowlist []string) (bool, error) {
+	if len(allowlist) == 0 {
+		return true, nil
+	}
+	host, err := memoize(c, "localhostname", LocalHostname)
+	if err != nil {
+		return false, err
+	}
+	host = strings.ToLower(host)
+	for _, pattern := range allowlist {
+		if matched, _ := path.Match(strings.ToLower(pattern), host); matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// measureSensor executes all functions of a sensor.
+func (ctx *Context) measureSensor(c context.Context, sensor Sensor) measurement {
+	if !ctx.profileSelected(sensor) {
+		return measurement{}
+	}
+	allowed, errAllowed := hostAllowed(c, sensor.HostAllowlist)
+	if errAllowed != nil {
+		return measurement{ran: true, err: fmt.Errorf("error during host allowlist check: %w", errAllowed)}
+	}
+	if !allowed {
+		return measurement{}
+	}
+	if sensor.ReportsFunction != nil {
+		return ctx.measureReports(c, sensor)
+	}
+	host, errHost := sensor.HostNameFunction()
+	if errHost != nil {
+		return measurement{ran: true, err: fmt.Errorf("error during hostname function call: %w", errHost)}
+	}
+	o := ctx.optionsFor(sensor)
+	host = o.trim(host)
+	if o.hostTransform != nil {
+		original := host
+		if host = o.hostTransform(host); host == "" {
+			return measurement{ran: true,
+				err: fmt.Errorf("host transformation returned an empty host name for %q", original)}
+		}
+	}
+	resource, errResource := sensor.ResourceNameFunction()
+	if errResource != nil {
+		return measurement{ran: true, host: host,
+			err: fmt.Errorf("error during resource name function call: %w", errResource)}
+	}
+	resource = o.resourcePrefix + o.trim(resource)
+	if err := ValidateResourceName(resource); err != nil {
+		return measurement{ran: true, host: host, err: err}
+	}
+	var value string
+	var errMeasurement error
+	info := &callInfo{}
+	if sensor.MeasurementContextFunction != nil {
+		value, errMeasurement = sensor.MeasurementContextFunction(context.WithValue(c, callKey{}, info))
+	} else {
+		value, errMeasurement = sensor.MeasurementFunction()
+	}
+	if info.measuredAt.IsZero() {
+		info.measuredAt = ctx.clock.Now()
+	}
+	if errMeasurement == nil {
+		value, errMeasurement = ctx.checkValue(sensor, value)
+	}
+	if errors.Is(errMeasurement, ErrClear) {
+		return measurement{ran: true, skipped: true, cleared: true, host: host, resource: resource}
+	}
+	if errors.Is(errMeasurement, ErrSkip) || (errMeasurement == nil && value == "") {
+		return measurement{ran: true, skipped: true, host: host, resource: resource}
+	}
+	if errMeasurement != nil {
+		return measurement{ran: true, host: host, resource: resource,
+			err: fmt.Errorf("error during measurement function call: %w", errMeasurement)}
+	}
+	return measurement{ran: true, host: host, resource: resource, value: value, measuredAt: info.measuredAt}
+}
+
+// checkValue trims a measured value (see WithTrimSpace), checks it
+// against the ValuePattern of the sensor, formats it with the Precision
+// of the sensor or the value formatter of the context and checks that
+// Grid Engine can parse it. An empty value is returned unchanged.
+func (ctx *Context) checkValue(sensor Sensor, value string) (string, error) {
+	o := ctx.optionsFor(sensor)
+	value = o.trim(value)
+	if sensor.ValuePattern != nil && value != "" && !sensor.ValuePattern.MatchString(value) {
+		return "", fmt.Errorf("value %q does not match the pattern %s", value, sensor.ValuePattern)
+	}
+	if sensor.Precision != nil {
+		value = formatPrecision(value, *sensor.Precision)
+	} else if o.valueFormatter != nil {
+		value = o.valueFormatter(value)
+	}
+	if value == "" {
+		return "", nil
+	}
+	if notFiniteValue(value) {
+		return "", fmt.Errorf("%w: %q", ErrNotFinite, value)
+	}
+	if err := ValidateTypedValue(value, sensor.Type); err != nil {
+		return "", err
+	}
+	if strings.EqualFold(sensor.Type, "INT") && !isInteger(value) {
+		return "", fmt.Errorf("value %q of INT sensor is not an integer", value)
+	}
+	return value, nil
+}
+
+// measureSensorAt executes the sensor with the given index unless it
+// has an Interval which has not elapsed since its last successful
+// measurement. In that case the last value is reported again.
+func (ctx *Context) measureSensorAt(c context.Context, i int, now time.Time) measurement {
+	sensor := ctx.sensors[i]
+	if sensor.Interval > 0 {
+		ctx.mutex.Lock()
+		state := ctx.states[i]
+		ctx.mutex.Unlock()
+		if state.valid && now.Sub(state.lastRun) < sensor.Interval {
+			m := state.last
+			m.reused = true
+			return m
+		}
+	}
+	m := ctx.measureSensor(context.WithValue(c, sensorIndexKey{}, i), sensor)
+	if sensor.Interval > 0 {
+		ctx.mutex.Lock()
+		state := &ctx.states[i]
+		state.lastRun, state.last, state.valid = now, m, m.err == nil && !m.cleared
+		ctx.mutex.Unlock()
+	}
+	return m
+}
+
+// measure executes all sensors of the context according to the
+// configured parallelism and returns the results in sensor order.
+// Sensors which were not executed because the cycle was aborted
+// have a result which did not run. The returned bool is false when
+// the cycle was aborted because of the FailFast policy or because
+// parent was cancelled.
+func (ctx *Context) measure(parent context.Context) ([]measurement, bool) {
+	ctx.mutex.Lock()
+	cycle := &cycleInfo{number: ctx.cycles + 1, start: ctx.clock.Now()}
+	ctx.mutex.Unlock()
+	cycle.finished = make([]chan struct{}, len(ctx.sensors))
+	cycle.prefixes = make([]string, len(ctx.sensors))
+	for i := range cycle.finished {
+		cycle.finished[i] = make(chan struct{})
+		cycle.prefixes[i] = ctx.optionsFor(ctx.sensors[i]).resourcePrefix
+	}
+	c, cancel := context.WithCancel(context.WithValue(parent, cycleKey{}, cycle))
+	defer cancel()
+	results := make([]measurement, len(ctx.sensors))
+	failFast := ctx.errorPolicy == FailFast
+
+	if ctx.parallelism <= 1 {
+		for i := range ctx.sensors {
+			if c.Err() != nil {
+				return results, false
+			}
+			results[i] = ctx.measureSensorAt(c, i, cycle.start)
+			cycle.finishSensor(i, results[i])
+			if results[i].failed() && failFast {
+				return results, false
+			}
+		}
+		return results, true
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	aborted := false
+	slots := make(chan struct{}, ctx.parallelism)
+	for i := range ctx.sensors {
+		select {
+		case slots <- struct{}{}:
+		case <-c.Done():
+		}
+		if c.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() { <-slots; wg.Done() }()
+			m := ctx.measureSensorAt(c, i, cycle.start)
+			cycle.finishSensor(i, m)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if aborted {
+				// the result is discarded
+				return
+			}
+			results[i] = m
+			if m.failed() && failFast {
+				aborted = true
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return results, !aborted
+}
+
+// unchanged checks if the value of a sensor with ReportOnChange can be
+// omitted because it was already reported recently.
+func (ctx *Context) unchanged(i int, r Report, now time.Time) bool {
+	sensor := ctx.sensors[i]
+	if !sensor.ReportOnChange {
+		return false
+	}
+	maxStaleness := sensor.MaxStaleness
+	if maxStaleness <= 0 {
+		maxStaleness = DefaultMaxStaleness
+	}
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	state := &ctx.states[i]
+	return !state.emittedAt.IsZero() && now.Sub(state.emittedAt) < maxStaleness &&
+		state.emitted.Host == r.Host && state.emitted.Resource == r.Resource &&
+		state.emitted.Value == r.Value
+}
+
+// commitEmitted updates the ReportOnChange state after a load report.
+// The sensors in changed had a value in the report, it is stored as
+// emitted when it was actually written. All other sensors with
+// ReportOnChange which are not in kept had no value in the report,
+// their state is reset so that their next value is written in any
+// case, since Grid Engine expires values which are not reported.
+func (ctx *Context) commitEmitted(changed map[int]Report, kept map[int]bool, written []Report, ok bool, now time.Time) {
+	inReport := make(map[[2]string]bool, len(written))
+	for _, r := range written {
+		inReport[[2]string{r.Host, r.Resource}] = true
+	}
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	for i := range ctx.sensors {
+		if !ctx.sensors[i].ReportOnChange || kept[i] {
+			continue
+		}
+		state := &ctx.states[i]
+		r, found := changed[i]
+		if found && ok && inReport[[2]string{r.Host, r.Resource}] {
+			state.emitted, state.emittedAt = r, now
+		} else {
+			state.emitted, state.emittedAt = Report{}, time.Time{}
+		}
+	}
+}
+
+// cycle performs one load report: it measures all sensors (or takes
+// their latest background measurements, see WithBackgroundMeasurement)
+// and writes the report framed by begin and end to w. The whole report
+// is written with a single Write call. Errors of sensors are logged to
+// stderr, an error writing the report is returned. When c is cancelled
+// during the measurements no report is written and the error of c is
+// returned. While the host is in maintenance (see WithMaintenanceCheck)
+// or the context is paused (see Pause) the maintenance report is
+// written instead. When all is true the values of sensors with
+// ReportOnChange are written even when they did not change.
+func (ctx *Context) cycle(c context.Context, w io.Writer, all bool) error {
+	if mode, paused := ctx.pausedMode(); paused {
+		return ctx.maintenanceCycle(w, mode)
+	}
+	if ctx.inMaintenance() {
+		return ctx.maintenanceCycle(w, ctx.maintenanceMode)
+	}
+	start := ctx.clock.Now()
+	ctx.mutex.Lock()
+	background := ctx.latest != nil
+	ctx.mutex.Unlock()
+	var results []measurement
+	var complete bool
+	if background {
+		results, complete = ctx.latestResults()
+	} else {
+		results, complete = ctx.measure(c)
+		if c.Err() != nil {
+			return c.Err()
+		}
+		ctx.logHostnameWarning()
+	}
+	var report, errorComplexes, cleared []Report
+	changed, kept := make(map[int]Report), make(map[int]bool)
+	for i, m := range results {
+		if !background {
+			ctx.logResult(i, m)
+		}
+		if r, ok := ctx.errorComplex(i, m, start); ok {
+			errorComplexes = append(errorComplexes, r)
+		}
+		if m.failed() {
+			continue
+		}
+		if m.cleared && complete && m.host != "" && !ctx.sensors[i].Shadow {
+			cleared = append(cleared, Report{Host: m.host, Resource: m.resource})
+		}
+		if !m.ran || m.skipped || !complete {
+			continue
+		}
+		if m.reports != nil {
+			for _, r := range m.reports {
+				r.Labels, r.Shadow = ctx.sensors[i].Labels, ctx.sensors[i].Shadow
+				if ctx.annotateAge(&r, start) {
+					report = append(report, r)
+				}
+			}
+			continue
+		}
+		r := Report{Host: m.host, Resource: m.resource, Value: m.value, MeasuredAt: m.measuredAt,
+			Labels: ctx.sensors[i].Labels, Shadow: ctx.sensors[i].Shadow}
+		if !ctx.annotateAge(&r, start) {
+			continue
+		}
+		if !all && ctx.unchanged(i, r, start) {
+			kept[i] = true
+			continue
+		}
+		changed[i] = r
+		report = append(report, r)
+	}
+	report, shadow := splitShadow(report)
+	report = append(report, errorComplexes...)
+	report = append(report, ctx.builtinReports(start)...)
+	report = ctx.groupReport(ctx.splitReport(report))
+	_, err := w.Write(ctx.formatReport(report, cleared))
+	ctx.commitEmitted(changed, kept, report, err == nil, start)
+	for _, r := range shadow {
+		ctx.logf("shadow value %s:%s:%s", r.Host, r.Resource, r.Value)
+	}
+	report = append(report, shadow...)
+	ctx.record(results, report, err == nil)
+	ctx.mutex.Lock()
+	ctx.lastCycleDuration = ctx.clock.Now().Sub(start)
+	ctx.mutex.Unlock()
+	ctx.writeSinks(report)
+	return err
+}
+
+// splitShadow separates the values of shadow sensors from the values
+// reported to Grid Engine.
+func splitShadow(report []Report) ([]Report, []Report) {
+	var reported, shadow []Report
+	for _, r := range report {
+		if r.Shadow {
+			shadow = append(shadow, r)
+		} else {
+			reported = append(reported, r)
+		}
+	}
+	return reported, shadow
+}
+
+// RunOnce measures all sensors once and writes a single load report
+// framed by begin and end to w, independent of any trigger. It writes
+// the same load report as Run does for each trigger of the execd, but
+// can not be cancelled like the load reports of Run on "quit".
+func (ctx *Context) RunOnce(w io.Writer) error {
+	return ctx.cycle(context.Background(), w, false)
+}
+
+// RunN writes exactly n load reports to w by calling RunOnce n times.
+// It stops at the first error writing a report. RunN is useful for
+// benchmarks and integration tests of the whole load sensor.
+func (ctx *Context) RunN(n int, w io.Writer) error {
+	for i := 0; i < n; i++ {
+		if err := ctx.RunOnce(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
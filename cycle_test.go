@@ -0,0 +1,136 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// testSensor creates a sensor for the host "host" which reports the
+// results of the given measurement function.
+func testSensor(resource string, measurement func() (string, error)) Sensor {
+	s := NewSensor(resource, measurement)
+	s.HostNameFunction = func() (string, error) { return "host", nil }
+	return s
+}
+
+// runReport writes one load report of the context and returns it.
+func runReport(t *testing.T, ctx *Context) string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := ctx.RunOnce(&out); err != nil {
+		t.Fatalf("RunOnce: %s", err)
+	}
+	return out.String()
+}
+
+func TestReportOnChangeAfterGap(t *testing.T) {
+	results := []error{nil, nil, ErrSkip, nil}
+	call := 0
+	s := testSensor("value", func() (string, error) {
+		err := results[call]
+		call++
+		return "1", err
+	})
+	s.ReportOnChange = true
+	ctx, err := Create([]Sensor{s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"begin\nhost:value:1\nend\n",
+		"begin\nend\n",
+		"begin\nend\n",
+		"begin\nhost:value:1\nend\n",
+	}
+	for i, e := range expected {
+		if report := runReport(t, ctx); report != e {
+			t.Errorf("report %d: expected %q, got %q", i, e, report)
+		}
+	}
+}
+
+func TestReportOnChangeAfterTruncation(t *testing.T) {
+	a, b := testSensor("a", func() (string, error) { return "1", nil }),
+		testSensor("b", func() (string, error) { return "2", nil })
+	a.ReportOnChange, b.ReportOnChange = true, true
+	ctx, err := CreateWithOptions([]Sensor{a, b}, WithMaxReportSize(len("begin\nhost:a:1\nend\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"begin\nhost:a:1\nend\n",
+		"begin\nhost:b:2\nend\n",
+		"begin\nend\n",
+	}
+	for i, e := range expected {
+		if report := runReport(t, ctx); report != e {
+			t.Errorf("report %d: expected %q, got %q", i, e, report)
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("closed") }
+
+func TestReportOnChangeAfterFailedWrite(t *testing.T) {
+	s := testSensor("value", func() (string, error) { return "1", nil })
+	s.ReportOnChange = true
+	ctx, err := Create([]Sensor{s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.RunOnce(failingWriter{}); err == nil {
+		t.Fatal("expected a write error")
+	}
+	if report := runReport(t, ctx); report != "begin\nhost:value:1\nend\n" {
+		t.Errorf("value not reported after failed write: %q", report)
+	}
+}
+
+func TestTrimSpace(t *testing.T) {
+	s := testSensor(" value\n", func() (string, error) { return "  42\n", nil })
+	s.HostNameFunction = func() (string, error) { return "host\n", nil }
+	ctx, err := Create([]Sensor{s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report := runReport(t, ctx); report != "begin\nhost:value:42\nend\n" {
+		t.Errorf("value was not trimmed: %q", report)
+	}
+}
+
+func TestZeroValuesAreReported(t *testing.T) {
+	var sensors []Sensor
+	for _, value := range []string{"0", "0.0", "-1", "-0.5"} {
+		value := value
+		sensors = append(sensors, testSensor("v"+value, func() (string, error) { return value, nil }))
+	}
+	sensors = append(sensors, testSensor("empty", func() (string, error) { return "", nil }),
+		testSensor("skip", func() (string, error) { return "0", ErrSkip }))
+	ctx, err := Create(sensors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "begin\nhost:v0:0\nhost:v0.0:0.0\nhost:v-1:-1\nhost:v-0.5:-0.5\nend\n"
+	if report := runReport(t, ctx); report != expected {
+		t.Errorf("expected %q, got %q", expected, report)
+	}
+}
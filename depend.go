@@ -0,0 +1,97 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// sensorIndexKey is the context key under which the index of the
+// sensor being measured is stored.
+type sensorIndexKey struct{}
+
+// finishSensor records the result of the sensor with the given index
+// in the cycle and releases sensors waiting for it in ReportedValue.
+func (cycle *cycleInfo) finishSensor(i int, m measurement) {
+	if cycle.finished == nil {
+		return
+	}
+	if m.ran && !m.skipped && m.err == nil {
+		cycle.mutex.Lock()
+		if cycle.values == nil {
+			cycle.values = make(map[string]string)
+		}
+		cycle.values[strings.TrimPrefix(m.resource, cycle.prefixes[i])] = m.value
+		cycle.mutex.Unlock()
+	}
+	close(cycle.finished[i])
+}
+
+// ReportedValue returns the value measured for resource in the current
+// load report by a sensor which comes before the calling sensor in
+// sensor order. It allows a MeasurementContextFunction to depend on
+// the values of other sensors, so dependencies must be listed before
+// the sensors using them. With WithParallelism the calling sensor waits
+// until all sensors before it are finished. The returned bool is false
+// when no earlier sensor reported the resource in this load report,
+// for example because it failed, was skipped or is not selected on
+// this host, and when called outside of a load report or with
+// WithBackgroundMeasurement. The resource is the name returned by the
+// ResourceNameFunction of the sensor, without the prefix set with
+// WithResourcePrefix, so sensors do not depend on the prefix.
+func ReportedValue(c context.Context, resource string) (string, bool) {
+	cycle := currentCycle(c)
+	if cycle == nil || cycle.finished == nil {
+		return "", false
+	}
+	if i, ok := c.Value(sensorIndexKey{}).(int); ok {
+		for j := 0; j < i && j < len(cycle.finished); j++ {
+			select {
+			case <-cycle.finished[j]:
+			case <-c.Done():
+				return "", false
+			}
+		}
+	}
+	cycle.mutex.Lock()
+	defer cycle.mutex.Unlock()
+	value, found := cycle.values[resource]
+	return value, found
+}
+
+// When returns a context aware measurement function which reports the
+// result of f only when the value reported for resource in the same
+// load report (see ReportedValue) fulfills condition, for example a
+// "degraded" flag which is only reported when the temperature is above
+// a threshold. Otherwise f is not executed and no value is reported.
+// No value is reported either when the resource has no value in the
+// load report, for example because its sensor failed. Like for
+// ReportedValue the resource is given without the resource prefix.
+func When(resource string, condition func(value string) bool, f func() (string, error)) func(context.Context) (string, error) {
+	return func(c context.Context) (string, error) {
+		value, found := ReportedValue(c, resource)
+		if !found {
+			return "", fmt.Errorf("%w: %s has no value in this load report", ErrSkip, resource)
+		}
+		if !condition(value) {
+			return "", ErrSkip
+		}
+		return f()
+	}
+}
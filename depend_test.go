@@ -0,0 +1,39 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestWhenWithResourcePrefix(t *testing.T) {
+	temperature := testSensor("temperature", func() (string, error) { return "90", nil })
+	degraded := testSensor("degraded", nil)
+	degraded.MeasurementContextFunction = When("temperature", func(value string) bool {
+		degrees, err := strconv.Atoi(value)
+		return err == nil && degrees > 80
+	}, func() (string, error) { return "1", nil })
+	ctx, err := CreateWithOptions([]Sensor{temperature, degraded}, WithResourcePrefix("site_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "begin\nhost:site_temperature:90\nhost:site_degraded:1\nend\n"
+	if report := runReport(t, ctx); report != expected {
+		t.Errorf("expected %q, got %q", expected, report)
+	}
+}
@@ -0,0 +1,527 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrBinaryNotFound is returned when a binary which should be
+	// executed does not exist, for example because SGE_ROOT points to
+	// the wrong directory.
+	ErrBinaryNotFound = errors.New("binary not found")
+	// ErrCommandFailed is returned when a binary was executed but
+	// failed, for example with a non-zero exit status.
+	ErrCommandFailed = errors.New("command failed")
+	// ErrCommandTimeout is returned when a binary did not finish
+	// within its timeout (see HostnameTimeout).
+	ErrCommandTimeout = errors.New("command timed out")
+)
+
+// HostnameTimeout is the time the gethostname binary of Grid Engine
+// may run before LocalHostname gives up, which bounds the startup of
+// the load sensor when SGE_ROOT is on a slow file system. HostnameTimeout
+// is a deadline of the operating system and independent of the Clock.
+// Zero waits forever. It is read without synchronization and must only
+// be set during the initialization of the program, before Run is
+// called.
+var HostnameTimeout = 10 * time.Second
+
+// HostnameFallback enables the fallback of LocalHostname to the host
+// name of the operating system (os.Hostname) when the gethostname
+// binary timed out (see HostnameTimeout). A warning is logged by the
+// context measuring the sensor (see WithLogOutput) since the name can
+// differ from the one Grid Engine uses for the host. Like the result
+// of the binary the fallback name is cached, so the slow path is
+// executed at most once. The fallback is disabled by default. Like
+// HostnameTimeout it must only be set before Run is called.
+var HostnameFallback = false
+
+// Runner executes external commands. Run returns what the command
+// wrote to stdout. When the command fails with an *exec.ExitError its
+// Stderr field is included in the error message. An error wrapping
+// exec.ErrNotFound or fs.ErrNotExist reports a missing binary.
+type Runner interface {
+	Run(name string, args ...string) ([]byte, error)
+}
+
+// RunnerFunc adapts a function to the Runner interface, for example
+// to replace the Grid Engine binaries by canned output in tests.
+type RunnerFunc func(name string, args ...string) ([]byte, error)
+
+func (f RunnerFunc) Run(name string, args ...string) ([]byte, error) {
+	return f(name, args...)
+}
+
+// contextRunner is implemented by runners which can stop a command
+// when its context is done.
+type contextRunner interface {
+	RunContext(c context.Context, name string, args ...string) ([]byte, error)
+}
+
+// execRunner is the Runner executing commands with os/exec.
+type execRunner struct{}
+
+func (execRunner) Run(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).Output()
+}
+
+func (execRunner) RunContext(c context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(c, name, args...).Output()
+}
+
+// runTimeout executes a command with the runner and returns an error
+// wrapping ErrCommandTimeout when it does not finish within timeout.
+// Commands of runners which can not stop them (see contextRunner) keep
+// running in the background after the timeout.
+func runTimeout(runner Runner, timeout time.Duration, name string, args ...string) ([]byte, error) {
+	if timeout <= 0 {
+		return runner.Run(name, args...)
+	}
+	c, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	type result struct {
+		out []byte
+		err error
+	}
+	results := make(chan result, 1)
+	go func() {
+		var r result
+		if cr, ok := runner.(contextRunner); ok {
+			r.out, r.err = cr.RunContext(c, name, args...)
+		} else {
+			r.out, r.err = runner.Run(name, args...)
+		}
+		results <- r
+	}()
+	select {
+	case r := <-results:
+		if c.Err() == nil {
+			return r.out, r.err
+		}
+	case <-c.Done():
+	}
+	return nil, fmt.Errorf("%w: %s after %s", ErrCommandTimeout, name, timeout)
+}
+
+var (
+	runnerMutex   sync.Mutex
+	defaultRunner Runner = execRunner{}
+)
+
+// SetDefaultRunner replaces the Runner executing all external commands
+// of the package: the Grid Engine binaries used by Arch and
+// LocalHostname as well as the commands of CommandMeasurement, the
+// license and the GPU sensors. It allows to test load sensors without
+// the real binaries or an SGE_ROOT. Passing nil restores os/exec.
+func SetDefaultRunner(r Runner) {
+	if r == nil {
+		r = execRunner{}
+	}
+	runnerMutex.Lock()
+	defaultRunner = r
+	runnerMutex.Unlock()
+	// detection results of the previous runner are discarded
+	detectorMutex.Lock()
+	detector = nil
+	detectorMutex.Unlock()
+}
+
+// currentRunner returns the runner set by SetDefaultRunner.
+func currentRunner() Runner {
+	runnerMutex.Lock()
+	defer runnerMutex.Unlock()
+	return defaultRunner
+}
+
+// runCommandWith executes a binary with the given runner and returns
+// its trimmed output. A missing binary is reported as error wrapping
+// ErrBinaryNotFound. When the binary fails the returned error wraps
+// ErrCommandFailed and contains the output the binary wrote to stdout
+// and stderr so that diagnostic messages are not lost.
+func runCommandWith(runner Runner, path string, args ...string) (string, error) {
+	return runCommandTimeout(runner, 0, path, args...)
+}
+
+// runCommandTimeout is runCommandWith with a timeout (see runTimeout).
+func runCommandTimeout(runner Runner, timeout time.Duration, path string, args ...string) (string, error) {
+	out, err := runTimeout(runner, timeout, path, args...)
+	if errors.Is(err, ErrCommandTimeout) {
+		return "", err
+	}
+	output := strings.TrimSpace(string(out))
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s: %w", ErrBinaryNotFound, path, err)
+	}
+	if err != nil {
+		var diagnostics []string
+		if output != "" {
+			diagnostics = append(diagnostics, output)
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			if stderr := strings.TrimSpace(string(exitErr.Stderr)); stderr != "" {
+				diagnostics = append(diagnostics, stderr)
+			}
+		}
+		if len(diagnostics) > 0 {
+			return output, fmt.Errorf("%w: %s: %w: %s", ErrCommandFailed, path, err, strings.Join(diagnostics, "; "))
+		}
+		return output, fmt.Errorf("%w: %s: %w", ErrCommandFailed, path, err)
+	}
+	return output, nil
+}
+
+// runCommand executes a binary with the runner set by
+// SetDefaultRunner (see runCommandWith).
+func runCommand(path string, args ...string) (string, error) {
+	return runCommandWith(currentRunner(), path, args...)
+}
+
+// runCommandCycle executes a binary like runCommand. Within one load
+// report a command is executed only once for the same arguments, even
+// when several sensors report on its output.
+func runCommandCycle(c context.Context, path string, args []string) (string, error) {
+	key := "exec:" + path + "\x00" + strings.Join(args, "\x00")
+	return memoize(c, key, func() (string, error) {
+		return runCommand(path, args...)
+	})
+}
+
+// CommandMeasurement returns a measurement function which executes
+// the command name with the given arguments and reports its trimmed
+// output as value. The command is executed by the runner set with
+// SetDefaultRunner. A missing binary is reported as error wrapping
+// ErrBinaryNotFound, a failing command as error wrapping
+// ErrCommandFailed. The command is executed on every call, use
+// NewCommandSensor to share its output within a load report.
+func CommandMeasurement(name string, args ...string) func() (string, error) {
+	args = append([]string(nil), args...)
+	return func() (string, error) {
+		return runCommand(name, args...)
+	}
+}
+
+// NewCommandSensor creates a sensor for the local host reporting the
+// output of the command name like CommandMeasurement. Command sensors
+// with the same command and arguments share one execution per load
+// report. The output is not kept across load reports, set the
+// Interval of the sensor for that.
+func NewCommandSensor(resource, name string, args ...string) Sensor {
+	args = append([]string(nil), args...)
+	sensor := NewSensor(resource, nil)
+	sensor.MeasurementContextFunction = func(c context.Context) (string, error) {
+		return runCommandCycle(c, name, args)
+	}
+	return sensor
+}
+
+// exitCode executes the command and returns its exit status. An error
+// is only returned when the command could not be executed or did not
+// exit normally, for example because it was killed by a signal.
+func exitCode(name string, args []string) (int, error) {
+	_, err := runCommand(name, args...)
+	if err == nil {
+		return 0, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() >= 0 {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// ExitCodeMeasurement returns a measurement function which executes
+// the command name with the given arguments and reports its exit
+// status as value, for example for health checks which communicate
+// their result by the exit status only. The output of the command is
+// ignored. A command which exits non-zero is a valid measurement, an
+// error is returned when the command can not be started (wrapping
+// ErrBinaryNotFound when it does not exist) or is killed by a signal,
+// so no value is reported then. The command is executed by the runner
+// set with SetDefaultRunner.
+func ExitCodeMeasurement(name string, args ...string) func() (string, error) {
+	args = append([]string(nil), args...)
+	return func() (string, error) {
+		code, err := exitCode(name, args)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(code), nil
+	}
+}
+
+// ExitAvailabilityMeasurement returns a measurement function like
+// ExitCodeMeasurement which reports 1 when the command exits with
+// status 0 and 0 for any other exit status, for a BOOL complex telling
+// whether the checked service is available.
+func ExitAvailabilityMeasurement(name string, args ...string) func() (string, error) {
+	args = append([]string(nil), args...)
+	return func() (string, error) {
+		code, err := exitCode(name, args)
+		if err != nil {
+			return "", err
+		}
+		if code != 0 {
+			return "0", nil
+		}
+		return "1", nil
+	}
+}
+
+// normalizeRoot normalizes a Grid Engine installation directory. A
+// relative path is made absolute so that binary paths do not depend
+// on the working directory.
+func normalizeRoot(root string) string {
+	if root == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(root); err == nil {
+		return abs
+	}
+	return filepath.Clean(root)
+}
+
+// Detector determines the Grid Engine architecture and the local host
+// name of a Grid Engine installation by executing its arch script and
+// gethostname binary at the paths of its Layout. Successful results
+// are cached for the lifetime of the Detector, failures are retried on
+// the next call. A Detector is safe for concurrent use: concurrent
+// callers wait for a running detection instead of executing the
+// binaries again.
+type Detector struct {
+	root     string
+	layout   Layout
+	runner   Runner
+	mutex    sync.Mutex
+	arch     string
+	hostname string
+	// warning is the warning about a host name fallback which was not
+	// logged yet, it has its own mutex since mutex is held during the
+	// detection
+	warningMutex sync.Mutex
+	warning      string
+}
+
+// NewDetector creates a Detector for the Grid Engine installation in
+// sgeRoot with UGELayout. The runner executes the Grid Engine binaries,
+// nil uses os/exec.
+func NewDetector(sgeRoot string, runner Runner) *Detector {
+	return NewDetectorWithLayout(sgeRoot, UGELayout, runner)
+}
+
+// NewDetectorWithLayout creates a Detector for the Grid Engine
+// installation in sgeRoot whose binaries are located according to
+// layout (see NewDetector).
+func NewDetectorWithLayout(sgeRoot string, layout Layout, runner Runner) *Detector {
+	if runner == nil {
+		runner = execRunner{}
+	}
+	return &Detector{root: normalizeRoot(sgeRoot), layout: layout.withDefaults(), runner: runner}
+}
+
+// Root returns the normalized Grid Engine installation directory.
+func (d *Detector) Root() string {
+	return d.root
+}
+
+// Arch returns the Grid Engine architecture string determined by the
+// arch script (see the package level Arch function).
+func (d *Detector) Arch() (string, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.archLocked()
+}
+
+func (d *Detector) archLocked() (string, error) {
+	if d.arch != "" {
+		return d.arch, nil
+	}
+	if d.root == "" {
+		return "", fmt.Errorf("%w: %w", ErrArchDetection, ErrSGERootUnset)
+	}
+	arch, err := runCommandWith(d.runner, d.layout.archScript(d.root))
+	if errors.Is(err, ErrBinaryNotFound) {
+		return "", fmt.Errorf("%w: %w (is SGE_ROOT %s correct?)", ErrArchDetection, err, d.root)
+	}
+	if err != nil {
+		return arch, fmt.Errorf("%w: %w", ErrArchDetection, err)
+	}
+	if arch == "" {
+		return "", fmt.Errorf("%w: arch script returned no architecture", ErrArchDetection)
+	}
+	d.arch = arch
+	return arch, nil
+}
+
+// Hostname returns the local host name determined by the Grid Engine
+// gethostname binary (see the package level LocalHostname function).
+// The binary is stopped after HostnameTimeout, see HostnameFallback
+// for using the host name of the operating system then. When the
+// binary does not exist for the architecture, the one binary found in
+// another architecture directory of the installation is used. The
+// warning about a fallback is only logged for the Detector of
+// LocalHostname.
+func (d *Detector) Hostname() (string, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.hostname != "" {
+		return d.hostname, nil
+	}
+	arch, err := d.archLocked()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrHostnameResolution, err)
+	}
+	path := d.layout.hostnameBinary(d.root, arch)
+	hostname, err := runCommandTimeout(d.runner, HostnameTimeout, path, "-name")
+	if errors.Is(err, ErrBinaryNotFound) {
+		if found, ok := d.layout.findHostnameBinary(d.root); ok && found != path {
+			hostname, err = runCommandTimeout(d.runner, HostnameTimeout, found, "-name")
+		}
+	}
+	if errors.Is(err, ErrCommandTimeout) && HostnameFallback {
+		if fallback, errOS := os.Hostname(); errOS == nil && fallback != "" {
+			d.warningMutex.Lock()
+			d.warning = fmt.Sprintf("%s, using the host name %s of the operating system", err, fallback)
+			d.warningMutex.Unlock()
+			d.hostname = fallback
+			return fallback, nil
+		}
+	}
+	if errors.Is(err, ErrBinaryNotFound) {
+		return "", fmt.Errorf("%w: %w (is the architecture %s of SGE_ROOT %s correct?)",
+			ErrHostnameResolution, err, arch, d.root)
+	}
+	if err != nil {
+		return hostname, fmt.Errorf("%w: %w", ErrHostnameResolution, err)
+	}
+	if hostname == "" {
+		return "", fmt.Errorf("%w: gethostname returned no host name", ErrHostnameResolution)
+	}
+	d.hostname = hostname
+	return hostname, nil
+}
+
+var (
+	detectorMutex sync.Mutex
+	detector      *Detector
+)
+
+// defaultDetector returns the Detector used by the package level Arch
+// and LocalHostname functions. It is created from the SGE_ROOT
+// environment variable and the current layout (see DefaultLayout)
+// with the runner set by SetDefaultRunner and replaced when one of
+// them changes.
+func defaultDetector() *Detector {
+	root := normalizeRoot(os.Getenv("SGE_ROOT"))
+	layout := currentLayout()
+	detectorMutex.Lock()
+	defer detectorMutex.Unlock()
+	if detector == nil || detector.root != root || detector.layout != layout {
+		detector = NewDetectorWithLayout(root, layout, currentRunner())
+	}
+	return detector
+}
+
+// takeHostnameWarning returns the warning about a host name fallback
+// of the default detector which was not logged yet and clears it.
+func takeHostnameWarning() string {
+	detectorMutex.Lock()
+	d := detector
+	detectorMutex.Unlock()
+	if d == nil {
+		return ""
+	}
+	d.warningMutex.Lock()
+	defer d.warningMutex.Unlock()
+	warning := d.warning
+	d.warning = ""
+	return warning
+}
+
+// logHostnameWarning logs the warning about a host name fallback of
+// LocalHostname (see HostnameFallback).
+func (ctx *Context) logHostnameWarning() {
+	if warning := takeHostnameWarning(); warning != "" {
+		ctx.logf("warning: %s", warning)
+	}
+}
+
+// StartupError is returned by WaitForHostname when the local host name
+// could not be determined within the startup timeout.
+type StartupError struct {
+	// Attempts is the number of detections which were executed.
+	Attempts int
+	// Elapsed is the time spent waiting.
+	Elapsed time.Duration
+	// Err is the error of the last attempt.
+	Err error
+}
+
+func (e *StartupError) Error() string {
+	return fmt.Sprintf("startup detection failed after %d attempts in %s: %s",
+		e.Attempts, e.Elapsed.Round(time.Second), e.Err)
+}
+
+func (e *StartupError) Unwrap() error {
+	return e.Err
+}
+
+// maxStartupBackoff is the maximum time between two attempts of
+// WaitForHostname.
+const maxStartupBackoff = 30 * time.Second
+
+// WaitForHostname determines the Grid Engine architecture and the local
+// host name (see LocalHostname) and retries failed attempts with an
+// exponential backoff starting at one second until timeout elapsed.
+// This covers hosts where the load sensor is started before SGE_ROOT
+// is available, for example on a shared file system which is not yet
+// mounted after a reboot. The final failure is returned as
+// *StartupError wrapping the error of the last attempt.
+func WaitForHostname(timeout time.Duration) (string, error) {
+	return waitForHostname(currentClock(), timeout)
+}
+
+func waitForHostname(clock Clock, timeout time.Duration) (string, error) {
+	start := clock.Now()
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		host, err := LocalHostname()
+		if err == nil {
+			return host, nil
+		}
+		elapsed := clock.Now().Sub(start)
+		if elapsed+backoff > timeout {
+			return "", &StartupError{Attempts: attempt, Elapsed: elapsed, Err: err}
+		}
+		clock.Sleep(backoff)
+		if backoff *= 2; backoff > maxStartupBackoff {
+			backoff = maxStartupBackoff
+		}
+	}
+}
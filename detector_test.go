@@ -0,0 +1,228 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeArchScript creates a Grid Engine installation whose arch script
+// is the given shell script and returns its root directory.
+func fakeArchScript(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake arch script is a shell script")
+	}
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "util"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "util", "arch"), []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// fakeGridEngine returns a runner replacing the arch script and the
+// gethostname binary of a Grid Engine installation by canned output.
+func fakeGridEngine(arch, hostname string) RunnerFunc {
+	return func(name string, args ...string) ([]byte, error) {
+		switch filepath.Base(name) {
+		case "arch":
+			return []byte(arch + "\n"), nil
+		case "gethostname":
+			return []byte(hostname + "\n"), nil
+		}
+		return nil, errors.New("unexpected command " + name)
+	}
+}
+
+func TestDetectorHostnameEmpty(t *testing.T) {
+	d := NewDetector("/opt/uge", fakeGridEngine("lx-amd64", ""))
+	host, err := d.Hostname()
+	if !errors.Is(err, ErrHostnameResolution) {
+		t.Fatalf("expected ErrHostnameResolution, got %q, %v", host, err)
+	}
+	if host != "" {
+		t.Errorf("expected no host name, got %q", host)
+	}
+}
+
+func TestArchDiagnostics(t *testing.T) {
+	root := fakeArchScript(t, "echo 'ERROR: SGE_ROOT not set inside arch script.'\necho 'unknown architecture' >&2\nexit 1\n")
+	_, err := NewDetector(root, nil).Arch()
+	if !errors.Is(err, ErrArchDetection) {
+		t.Fatalf("expected ErrArchDetection, got %v", err)
+	}
+	for _, diagnostic := range []string{"ERROR: SGE_ROOT not set inside arch script.", "unknown architecture"} {
+		if !strings.Contains(err.Error(), diagnostic) {
+			t.Errorf("error %q does not contain the output %q of the arch script", err, diagnostic)
+		}
+	}
+}
+
+func TestArchBinaryNotFound(t *testing.T) {
+	root := t.TempDir()
+	_, err := NewDetector(root, nil).Arch()
+	if !errors.Is(err, ErrBinaryNotFound) || !errors.Is(err, ErrArchDetection) {
+		t.Fatalf("expected ErrBinaryNotFound and ErrArchDetection, got %v", err)
+	}
+	if errors.Is(err, ErrCommandFailed) {
+		t.Errorf("a missing binary is reported as failed command: %v", err)
+	}
+	if !strings.Contains(err.Error(), "is SGE_ROOT "+root+" correct?") {
+		t.Errorf("error %q does not point to SGE_ROOT", err)
+	}
+}
+
+func TestArchCommandFailed(t *testing.T) {
+	root := fakeArchScript(t, "echo 'arch: broken' >&2\nexit 3\n")
+	_, err := NewDetector(root, nil).Arch()
+	if !errors.Is(err, ErrCommandFailed) || !errors.Is(err, ErrArchDetection) {
+		t.Fatalf("expected ErrCommandFailed and ErrArchDetection, got %v", err)
+	}
+	if errors.Is(err, ErrBinaryNotFound) {
+		t.Errorf("a failing binary is reported as missing: %v", err)
+	}
+	if !strings.Contains(err.Error(), "arch: broken") {
+		t.Errorf("error %q does not contain stderr", err)
+	}
+}
+
+func TestHostnameBinaryNotFound(t *testing.T) {
+	runner := RunnerFunc(func(name string, args ...string) ([]byte, error) {
+		if filepath.Base(name) == "arch" {
+			return []byte("lx-amd64\n"), nil
+		}
+		return nil, &os.PathError{Op: "fork/exec", Path: name, Err: os.ErrNotExist}
+	})
+	_, err := NewDetector("/opt/uge", runner).Hostname()
+	if !errors.Is(err, ErrBinaryNotFound) || !errors.Is(err, ErrHostnameResolution) {
+		t.Fatalf("expected ErrBinaryNotFound and ErrHostnameResolution, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "architecture lx-amd64") {
+		t.Errorf("error %q does not name the architecture", err)
+	}
+}
+
+func TestSetDefaultRunner(t *testing.T) {
+	t.Setenv("SGE_ROOT", "/opt/uge")
+	t.Setenv(ArchScriptEnv, "")
+	t.Setenv(HostnameBinaryEnv, "")
+	var commands []string
+	SetDefaultRunner(RunnerFunc(func(name string, args ...string) ([]byte, error) {
+		commands = append(commands, strings.Join(append([]string{name}, args...), " "))
+		return fakeGridEngine("lx-amd64", "node1")(name, args...)
+	}))
+	t.Cleanup(func() { SetDefaultRunner(nil) })
+	if arch, err := Arch(); err != nil || arch != "lx-amd64" {
+		t.Errorf("Arch: got %q, %v", arch, err)
+	}
+	if host, err := LocalHostname(); err != nil || host != "node1" {
+		t.Errorf("LocalHostname: got %q, %v", host, err)
+	}
+	if _, err := CommandMeasurement("/usr/bin/true")(); err == nil {
+		t.Error("CommandMeasurement did not use the runner")
+	}
+	expected := []string{
+		filepath.Join("/opt/uge", "util", "arch"),
+		filepath.Join("/opt/uge", "utilbin", "lx-amd64", "gethostname") + " -name",
+		"/usr/bin/true",
+	}
+	if strings.Join(commands, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected the commands %q, got %q", expected, commands)
+	}
+}
+
+func TestHostnameFallbackWarning(t *testing.T) {
+	t.Setenv("SGE_ROOT", "/opt/uge")
+	t.Setenv(ArchScriptEnv, "")
+	t.Setenv(HostnameBinaryEnv, "")
+	timeout, fallback := HostnameTimeout, HostnameFallback
+	HostnameTimeout, HostnameFallback = 10*time.Millisecond, true
+	SetDefaultRunner(RunnerFunc(func(name string, args ...string) ([]byte, error) {
+		if filepath.Base(name) == "gethostname" {
+			time.Sleep(time.Second)
+		}
+		return fakeGridEngine("lx-amd64", "node1")(name, args...)
+	}))
+	t.Cleanup(func() {
+		HostnameTimeout, HostnameFallback = timeout, fallback
+		SetDefaultRunner(nil)
+	})
+	expected, err := os.Hostname()
+	if err != nil {
+		t.Skip("no host name of the operating system")
+	}
+	logs := &logRecorder{}
+	ctx, err := CreateWithOptions([]Sensor{NewSensor("value", func() (string, error) { return "1", nil })},
+		WithLogOutput(logs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report := runReport(t, ctx); report != "begin\n"+expected+":value:1\nend\n" {
+		t.Errorf("unexpected report %q", report)
+	}
+	if n := logs.count("using the host name " + expected + " of the operating system"); n != 1 {
+		t.Errorf("expected one warning in the log, got %d: %q", n, logs.logs.String())
+	}
+	runReport(t, ctx)
+	if n := logs.count("warning:"); n != 1 {
+		t.Errorf("the warning was logged %d times", n)
+	}
+}
+
+func TestCommandSensorsShareExecution(t *testing.T) {
+	var mutex sync.Mutex
+	executions := map[string]int{}
+	SetDefaultRunner(RunnerFunc(func(name string, args ...string) ([]byte, error) {
+		command := strings.Join(append([]string{name}, args...), " ")
+		mutex.Lock()
+		executions[command]++
+		mutex.Unlock()
+		return []byte(command), nil
+	}))
+	t.Cleanup(func() { SetDefaultRunner(nil) })
+	sensors := []Sensor{
+		NewCommandSensor("a", "/bin/probe", "-x"),
+		NewCommandSensor("b", "/bin/probe", "-x"),
+		NewCommandSensor("c", "/bin/probe", "-y"),
+	}
+	for i := range sensors {
+		sensors[i].HostNameFunction = func() (string, error) { return "host", nil }
+	}
+	ctx, err := Create(sensors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "begin\nhost:a:/bin/probe -x\nhost:b:/bin/probe -x\nhost:c:/bin/probe -y\nend\n"
+	for cycle := 1; cycle <= 2; cycle++ {
+		if report := runReport(t, ctx); report != expected {
+			t.Errorf("unexpected report %q", report)
+		}
+		if executions["/bin/probe -x"] != cycle || executions["/bin/probe -y"] != cycle {
+			t.Errorf("expected each command to run once per load report, got %v after %d reports", executions, cycle)
+		}
+	}
+}
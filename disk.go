@@ -0,0 +1,151 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"context"
+	"errors"
+	"strconv"
+)
+
+// DiskFreePercentPrecision is the number of digits after the decimal
+// point of the percentages reported by DiskFreePercentMeasurement. A
+// negative precision uses the smallest number of digits necessary to
+// represent the value exactly. Changes only affect measurements created
+// afterwards.
+var DiskFreePercentPrecision = 1
+
+// fsUsage contains the capacity and the free space of a file system.
+// bytesFree is the space available to unprivileged users.
+type fsUsage struct {
+	bytesTotal  uint64
+	bytesFree   uint64
+	inodesTotal uint64
+	inodesFree  uint64
+}
+
+// statfsCycle returns the usage of the file system containing path.
+// Within one load report statfs is executed only once per path, even
+// when several sensors report on the same file system.
+func statfsCycle(c context.Context, path string) (fsUsage, error) {
+	return memoize(c, "statfs:"+path, func() (fsUsage, error) {
+		return statfs(path)
+	})
+}
+
+// fsMeasurement creates a context aware measurement reporting a
+// value derived from the usage of the file system containing path.
+func fsMeasurement(path string, value func(fsUsage) string) func(context.Context) (string, error) {
+	return func(c context.Context) (string, error) {
+		usage, err := statfsCycle(c, path)
+		if err != nil {
+			return "", err
+		}
+		return value(usage), nil
+	}
+}
+
+// fsValueMeasurement is like fsMeasurement for values which can not
+// be derived from every file system.
+func fsValueMeasurement(path string, value func(fsUsage) (string, error)) func(context.Context) (string, error) {
+	return func(c context.Context) (string, error) {
+		usage, err := statfsCycle(c, path)
+		if err != nil {
+			return "", err
+		}
+		return value(usage)
+	}
+}
+
+// newFsSensor creates a sensor for the local host reporting a value
+// derived from the usage of the file system containing path.
+func newFsSensor(resource, path string, value func(fsUsage) string) Sensor {
+	sensor := NewSensor(resource, nil)
+	sensor.MeasurementContextFunction = fsMeasurement(path, value)
+	return sensor
+}
+
+func bytesFree(usage fsUsage) string  { return strconv.FormatUint(usage.bytesFree, 10) }
+func inodesFree(usage fsUsage) string { return strconv.FormatUint(usage.inodesFree, 10) }
+
+// DiskFreeMeasurement returns a measurement function reporting the
+// free space in bytes (available to unprivileged users) of the file
+// system containing path. An error is returned when the path can not
+// be accessed.
+func DiskFreeMeasurement(path string) func() (string, error) {
+	f := fsMeasurement(path, bytesFree)
+	return func() (string, error) { return f(context.Background()) }
+}
+
+// NewDiskFreeSensor creates a sensor reporting the free space in bytes
+// of the file system containing path as resource. Sensors reporting
+// on the same path share one statfs call per load report.
+func NewDiskFreeSensor(resource, path string) Sensor {
+	return newFsSensor(resource, path, bytesFree)
+}
+
+// InodesFreeMeasurement returns a measurement function reporting the
+// number of free inodes of the file system containing path. File
+// systems can run out of inodes while there is still space left, which
+// makes jobs creating many small files fail. An error is returned when
+// the path can not be accessed.
+func InodesFreeMeasurement(path string) func() (string, error) {
+	f := fsMeasurement(path, inodesFree)
+	return func() (string, error) { return f(context.Background()) }
+}
+
+// NewInodesFreeSensor creates a sensor reporting the number of free
+// inodes of the file system containing path as resource. Sensors
+// reporting on the same path share one statfs call per load report.
+func NewInodesFreeSensor(resource, path string) Sensor {
+	return newFsSensor(resource, path, inodesFree)
+}
+
+// freePercent returns a function formatting the free space of a file
+// system as percentage of its total size.
+func freePercent(precision int) func(fsUsage) (string, error) {
+	return func(usage fsUsage) (string, error) {
+		if usage.bytesTotal == 0 {
+			return "", errors.New("file system reports a total size of 0 bytes")
+		}
+		percent := 100 * float64(usage.bytesFree) / float64(usage.bytesTotal)
+		if precision < 0 {
+			return formatFloat(percent), nil
+		}
+		return strconv.FormatFloat(percent, 'f', precision, 64), nil
+	}
+}
+
+// DiskFreePercentMeasurement returns a measurement function reporting
+// the free space (available to unprivileged users) of the file system
+// containing path as percentage of its total size, formatted with
+// DiskFreePercentPrecision digits. Unlike absolute bytes, percentages
+// allow the same load thresholds on nodes with different disk sizes.
+// An error is returned when the path can not be accessed.
+func DiskFreePercentMeasurement(path string) func() (string, error) {
+	f := fsValueMeasurement(path, freePercent(DiskFreePercentPrecision))
+	return func() (string, error) { return f(context.Background()) }
+}
+
+// NewDiskFreePercentSensor creates a sensor reporting the free space
+// of the file system containing path in percent as resource (see
+// DiskFreePercentMeasurement).
+func NewDiskFreePercentSensor(resource, path string) Sensor {
+	sensor := NewSensor(resource, nil)
+	sensor.MeasurementContextFunction = fsValueMeasurement(path, freePercent(DiskFreePercentPrecision))
+	return sensor
+}
@@ -0,0 +1,82 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+// ECCErrorType selects which ECC memory errors are counted.
+type ECCErrorType int
+
+const (
+	// ECCCorrected counts corrected (single bit) errors. A rising count
+	// often predicts failing memory.
+	ECCCorrected ECCErrorType = iota
+	// ECCUncorrected counts uncorrected errors which usually crashed
+	// the affected processes.
+	ECCUncorrected
+)
+
+// edacControllers is the glob matching the memory controllers known
+// to the EDAC subsystem of the kernel.
+const edacControllers = "/sys/devices/system/edac/mc/mc[0-9]*"
+
+// ECCErrorsMeasurement returns a measurement function reporting the
+// cumulative number of ECC memory errors of the given type summed over
+// all memory controllers (ce_count and ue_count of EDAC in
+// /sys/devices/system/edac). The counters are reset at boot only, use
+// a rate to derive an error rate. When EDAC is not available (no ECC
+// memory or no EDAC driver loaded) an error is returned instead of 0.
+// It is only supported on Linux.
+func ECCErrorsMeasurement(t ECCErrorType) func() (string, error) {
+	file := "ce_count"
+	if t == ECCUncorrected {
+		file = "ue_count"
+	}
+	return func() (string, error) {
+		if err := requireLinux(); err != nil {
+			return "", err
+		}
+		controllers, err := filepath.Glob(edacControllers)
+		if err != nil {
+			return "", err
+		}
+		if len(controllers) == 0 {
+			return "", errors.New("no EDAC memory controllers found in /sys/devices/system/edac")
+		}
+		var total uint64
+		for _, controller := range controllers {
+			count, err := readUintFile(filepath.Join(controller, file))
+			if err != nil {
+				return "", fmt.Errorf("can not read ECC errors of %s: %w", controller, err)
+			}
+			total += count
+		}
+		return strconv.FormatUint(total, 10), nil
+	}
+}
+
+// NewECCErrorsSensor creates a sensor reporting the cumulative number
+// of ECC memory errors of the given type (see ECCErrorsMeasurement) as
+// resource.
+func NewECCErrorsSensor(resource string, t ECCErrorType) Sensor {
+	return NewSensor(resource, ECCErrorsMeasurement(t))
+}
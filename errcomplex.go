@@ -0,0 +1,77 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import "time"
+
+// DefaultErrorSuffix is the suffix of the error complexes used by
+// WithErrorComplexes when no suffix is given.
+const DefaultErrorSuffix = "_error"
+
+// WithErrorComplexes reports for each sensor an error complex named
+// like the resource of the sensor followed by suffix, for example
+// "gpu_temp_error" for the sensor "gpu_temp" with the DefaultErrorSuffix
+// used for an empty suffix. Its value is 1 when the measurement of the
+// sensor failed in the load report and 0 otherwise, so that a failing
+// sensor becomes visible in qhost and can be monitored on the Grid
+// Engine side instead of only missing from the load report. The value
+// goes back to 0 with the first load report in which the sensor does
+// not fail. The error complexes need to be defined as INT complexes in
+// Grid Engine.
+//
+// When the host name or the resource name of the sensor can not be
+// determined, the names of its last measurement are used. Without
+// such a measurement no error complex can be reported. Sensors with a
+// ReportsFunction, shadow sensors and sensors which are not measured
+// on this host (see HostAllowlist and Profiles) have no error complex.
+func WithErrorComplexes(suffix string) Option {
+	return func(ctx *Context) {
+		if suffix == "" {
+			suffix = DefaultErrorSuffix
+		}
+		ctx.errorSuffix = suffix
+	}
+}
+
+// errorComplex returns the error complex of the sensor with the given
+// index for its measurement m.
+func (ctx *Context) errorComplex(i int, m measurement, start time.Time) (Report, bool) {
+	sensor := ctx.sensors[i]
+	if ctx.errorSuffix == "" || !m.ran || sensor.ReportsFunction != nil || sensor.Shadow {
+		return Report{}, false
+	}
+	host, resource := m.host, m.resource
+	if host == "" || resource == "" {
+		ctx.mutex.Lock()
+		if host == "" {
+			host = ctx.stats[i].Host
+		}
+		if resource == "" {
+			resource = ctx.stats[i].Resource
+		}
+		ctx.mutex.Unlock()
+	}
+	if host == "" || resource == "" {
+		return Report{}, false
+	}
+	value := "0"
+	if m.err != nil {
+		value = "1"
+	}
+	return Report{Host: host, Resource: resource + ctx.errorSuffix, Value: value, MeasuredAt: start,
+		Labels: sensor.Labels}, true
+}
@@ -0,0 +1,90 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import "time"
+
+// DefaultErrorLogInterval is the default time within which a repeated
+// identical error of a sensor is logged only once.
+const DefaultErrorLogInterval = 5 * time.Minute
+
+// WithErrorLogInterval limits the logging of sensor errors. The first
+// occurrence of an error is logged immediately. When the sensor keeps
+// failing with the same error (including the phase, like the hostname
+// or the measurement function) it is logged again at most once per
+// interval, together with the number of failures since it was last
+// logged. The accumulated count is also logged when the sensor
+// succeeds again or fails with a different error. The default is
+// DefaultErrorLogInterval, an interval of 0 logs each error.
+func WithErrorLogInterval(d time.Duration) Option {
+	return func(ctx *Context) {
+		if d < 0 {
+			d = 0
+		}
+		ctx.errorLogInterval = d
+	}
+}
+
+// logResult logs the error of the measurement of the sensor with the
+// given index according to the error log interval.
+func (ctx *Context) logResult(i int, m measurement) {
+	if !m.ran || m.reused {
+		return
+	}
+	if ctx.errorLogInterval <= 0 {
+		if m.err != nil {
+			ctx.logf("%s", m.err)
+		}
+		return
+	}
+	now := ctx.clock.Now()
+	var message string
+	if m.err != nil {
+		message = m.err.Error()
+	}
+	ctx.mutex.Lock()
+	if i >= len(ctx.states) {
+		ctx.mutex.Unlock()
+		return
+	}
+	state := &ctx.states[i]
+	previous, suppressed, since := state.loggedError, state.suppressed, state.loggedAt
+	switch {
+	case message != "" && message == previous && now.Sub(since) < ctx.errorLogInterval:
+		state.suppressed++
+		ctx.mutex.Unlock()
+		return
+	case message != "":
+		state.loggedError, state.loggedAt, state.suppressed = message, now, 0
+	default:
+		state.loggedError, state.loggedAt, state.suppressed = "", time.Time{}, 0
+	}
+	ctx.mutex.Unlock()
+
+	if suppressed > 0 && message != previous {
+		ctx.logf("sensor %d failed %d more times in the last %s: %s",
+			i, suppressed, now.Sub(since).Round(time.Second), previous)
+	}
+	switch {
+	case message == "":
+	case message == previous && suppressed > 0:
+		ctx.logf("sensor %d failed %d times in the last %s: %s",
+			i, suppressed+1, now.Sub(since).Round(time.Second), message)
+	default:
+		ctx.logf("%s", message)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/dgruber/loadsensor"
+	"os"
+)
+
+func main() {
+	// each --sensor flag adds a sensor reporting the output of a command,
+	// like --sensor 'scratch_free=/usr/local/bin/scratch-free --mb'
+	var sensors loadsensor.SensorFlags
+	flag.Var(&sensors, "sensor", "resource=command whose output is reported as resource (repeatable)")
+	flag.Parse()
+
+	ctx, err := loadsensor.Create(sensors.Sensors)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// start the load sensor
+	ctx.Run()
+}
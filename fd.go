@@ -0,0 +1,91 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// fileHandles returns the number of file handles in use and the
+// maximum number of file handles of the host from /proc/sys/fs/file-nr
+// which contains the allocated handles, the allocated but unused
+// handles (always 0 since Linux 2.6) and the maximum.
+func fileHandles() (inUse, max uint64, err error) {
+	content, err := readProcFile("/proc/sys/fs/file-nr")
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) != 3 {
+		return 0, 0, fmt.Errorf("invalid /proc/sys/fs/file-nr: %q", content)
+	}
+	var values [3]uint64
+	for i, field := range fields {
+		if values[i], err = strconv.ParseUint(field, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid /proc/sys/fs/file-nr: %q", content)
+		}
+	}
+	if values[1] > values[0] {
+		return 0, 0, fmt.Errorf("invalid /proc/sys/fs/file-nr: %q", content)
+	}
+	return values[0] - values[1], values[2], nil
+}
+
+// FileDescriptorUsageMeasurement reports the percentage of the file
+// handles of the host which are in use: the allocated minus the unused
+// handles of /proc/sys/fs/file-nr divided by the maximum (fs.file-max),
+// with one digit. When the host runs out of file handles no process
+// can open files anymore. The per process limits (ulimit -n) are not
+// taken into account. It is only supported on Linux.
+func FileDescriptorUsageMeasurement() (string, error) {
+	inUse, max, err := fileHandles()
+	if err != nil {
+		return "", err
+	}
+	return percent(float64(inUse), float64(max)), nil
+}
+
+// FileDescriptorsFreeMeasurement reports the number of file handles of
+// the host which can still be allocated: the maximum (fs.file-max)
+// minus the handles in use (see FileDescriptorUsageMeasurement). It is
+// only supported on Linux.
+func FileDescriptorsFreeMeasurement() (string, error) {
+	inUse, max, err := fileHandles()
+	if err != nil {
+		return "", err
+	}
+	if inUse > max {
+		return "0", nil
+	}
+	return strconv.FormatUint(max-inUse, 10), nil
+}
+
+// NewFileDescriptorUsageSensor creates a sensor reporting the
+// percentage of file handles in use (see
+// FileDescriptorUsageMeasurement) as resource.
+func NewFileDescriptorUsageSensor(resource string) Sensor {
+	return NewSensor(resource, FileDescriptorUsageMeasurement)
+}
+
+// NewFileDescriptorsFreeSensor creates a sensor reporting the number
+// of free file handles (see FileDescriptorsFreeMeasurement) as
+// resource.
+func NewFileDescriptorsFreeSensor(resource string) Sensor {
+	return NewSensor(resource, FileDescriptorsFreeMeasurement)
+}
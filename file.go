@@ -0,0 +1,125 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileMeasurement returns a measurement function reporting the
+// content of the file at path with leading and trailing whitespace
+// removed. This is useful when another agent periodically writes the
+// current value into a file. When maxAge is greater than zero the
+// file is considered stale when its modification time is older than
+// maxAge and an error is returned. A missing file is an error as
+// well. In both cases no value is reported and Grid Engine keeps the
+// previous value until it expires.
+func FileMeasurement(path string, maxAge time.Duration) func() (string, error) {
+	clock := currentClock()
+	return func() (string, error) {
+		if maxAge > 0 {
+			info, err := os.Stat(path)
+			if err != nil {
+				return "", err
+			}
+			if age := clock.Now().Sub(info.ModTime()); age > maxAge {
+				return "", fmt.Errorf("file %s is stale: last modified %s ago (max age %s)",
+					path, age.Round(time.Second), maxAge)
+			}
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(content)), nil
+	}
+}
+
+// NewFileSensor creates a sensor reporting the content of the file at
+// path as resource (see FileMeasurement). The age of the file is not
+// checked.
+func NewFileSensor(resource, path string) Sensor {
+	return NewSensor(resource, FileMeasurement(path, 0))
+}
+
+// NewFileSensorWithMaxAge creates a sensor reporting the content of
+// the file at path as resource. No value is reported when the file
+// was not modified within maxAge (see FileMeasurement).
+func NewFileSensorWithMaxAge(resource, path string, maxAge time.Duration) Sensor {
+	return NewSensor(resource, FileMeasurement(path, maxAge))
+}
+
+// FileAgeMeasurement returns a measurement function reporting the
+// seconds since the file at path was last modified, for example to
+// tell whether a checkpoint was written recently. A modification time
+// in the future is reported as 0. A missing file is an error (wrapping
+// fs.ErrNotExist) while an old file always has a value.
+func FileAgeMeasurement(path string) func() (string, error) {
+	clock := currentClock()
+	return func() (string, error) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		age := clock.Now().Sub(info.ModTime())
+		if age < 0 {
+			age = 0
+		}
+		return strconv.FormatInt(int64(age/time.Second), 10), nil
+	}
+}
+
+// NewFileAgeSensor creates a sensor reporting the age of the file at
+// path in seconds as resource (see FileAgeMeasurement).
+func NewFileAgeSensor(resource, path string) Sensor {
+	return NewSensor(resource, FileAgeMeasurement(path))
+}
+
+// SysfsValue returns a function reading the single number of the file
+// at path, like the many value files of sysfs and procfs (for example
+// /sys/class/hwmon/hwmon0/fan1_input or
+// /sys/devices/system/cpu/cpu0/cpufreq/scaling_cur_freq). Only files
+// containing exactly one integer or decimal number, surrounded by
+// optional whitespace, are supported; files with several fields need a
+// measurement function of their own. A missing or unreadable file and
+// a content which is not a single number are errors.
+func SysfsValue(path string) func() (float64, error) {
+	return func() (float64, error) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return 0, err
+		}
+		text := strings.TrimSpace(string(content))
+		v, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s does not contain a single number: %q", path, text)
+		}
+		return v, nil
+	}
+}
+
+// NewSysfsSensor creates a sensor reporting the number in the file at
+// path multiplied by scale as resource (see SysfsValue and Scale), for
+// example a scale of 0.001 reports the millidegrees of a thermal zone
+// in degrees Celsius. A scale of 1 reports the number unchanged.
+func NewSysfsSensor(resource, path string, scale float64) Sensor {
+	return NewSensor(resource, Scale(SysfsValue(path), scale))
+}
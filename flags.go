@@ -0,0 +1,148 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// splitCommand splits a command line into words. Words are separated
+// by whitespace. Single quotes keep everything up to the next single
+// quote literally, double quotes keep whitespace and allow \" and \\
+// escapes, outside of quotes a backslash escapes the next character.
+// Nothing else is interpreted, there is no variable expansion,
+// globbing or piping.
+func splitCommand(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated single quote")
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case ch == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+					i++
+				}
+				word.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, errors.New("unterminated double quote")
+			}
+			inWord = true
+		case ch == '\\':
+			if i+1 >= len(s) {
+				return nil, errors.New("backslash at the end of the command")
+			}
+			i++
+			word.WriteByte(s[i])
+			inWord = true
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(ch)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// ParseSensorFlag creates a sensor from a specification of the form
+// "resource=command args..." which reports the output of the command
+// (see NewCommandSensor) as resource of the local host, for example
+//
+//	--sensor 'scratch_free=/usr/local/bin/scratch-free --mb'
+//
+// The resource must be a valid complex name. The command is split
+// into words without a shell: whitespace separates arguments, single
+// quotes keep their content literally, double quotes keep whitespace
+// and allow \" and \\, and a backslash outside of quotes escapes the
+// next character. Since the shell which runs the load sensor removes
+// one level of quoting, the whole specification is usually put into
+// single quotes and arguments containing whitespace into double quotes
+// inside of it. Pipes or variables require an explicit shell like
+// 'r=/bin/sh -c "df -m /tmp | tail -1"'.
+func ParseSensorFlag(spec string) (Sensor, error) {
+	resource, command, found := strings.Cut(spec, "=")
+	if !found {
+		return Sensor{}, fmt.Errorf("invalid sensor %q: expected resource=command", spec)
+	}
+	resource = strings.TrimSpace(resource)
+	if err := ValidateResourceName(resource); err != nil {
+		return Sensor{}, fmt.Errorf("invalid sensor %q: %w", spec, err)
+	}
+	args, err := splitCommand(command)
+	if err != nil {
+		return Sensor{}, fmt.Errorf("invalid sensor %q: %w", spec, err)
+	}
+	if len(args) == 0 {
+		return Sensor{}, fmt.Errorf("invalid sensor %q: no command", spec)
+	}
+	sensor := NewCommandSensor(resource, args[0], args[1:]...)
+	sensor.spec = resource + "=" + strings.TrimSpace(command)
+	return sensor, nil
+}
+
+// SensorFlags collects the sensors of repeated command line flags (see
+// ParseSensorFlag). It implements flag.Value, so a small main creates
+// a load sensor from flags with
+//
+//	var sensors loadsensor.SensorFlags
+//	flag.Var(&sensors, "sensor", "resource=command to report")
+//	flag.Parse()
+//	ctx, err := loadsensor.Create(sensors.Sensors)
+type SensorFlags struct {
+	Sensors []Sensor
+	specs   []string
+}
+
+// String returns the specifications of all collected sensors.
+func (f *SensorFlags) String() string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join(f.specs, ", ")
+}
+
+// Set parses one sensor specification and adds the sensor.
+func (f *SensorFlags) Set(spec string) error {
+	sensor, err := ParseSensorFlag(spec)
+	if err != nil {
+		return err
+	}
+	f.Sensors = append(f.Sensors, sensor)
+	f.specs = append(f.specs, spec)
+	return nil
+}
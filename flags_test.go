@@ -0,0 +1,64 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		words   []string
+	}{
+		{"", nil},
+		{" \t\n", nil},
+		{"/bin/df -m /tmp", []string{"/bin/df", "-m", "/tmp"}},
+		{"  a\t\tb  ", []string{"a", "b"}},
+		{`echo 'a b' "c d"`, []string{"echo", "a b", "c d"}},
+		{`echo 'it"s' "it's"`, []string{"echo", `it"s`, "it's"}},
+		{`echo '\n $HOME'`, []string{"echo", `\n $HOME`}},
+		{`echo "say \"hi\"" "a\\b" "c\d"`, []string{"echo", `say "hi"`, `a\b`, `c\d`}},
+		{`echo a\ b \'x\'`, []string{"echo", "a b", "'x'"}},
+		{`echo pre'fix'"ed" '' ""`, []string{"echo", "prefixed", "", ""}},
+		{`/bin/sh -c "df -m /tmp | tail -1"`, []string{"/bin/sh", "-c", "df -m /tmp | tail -1"}},
+	}
+	for _, test := range tests {
+		words, err := splitCommand(test.command)
+		if err != nil {
+			t.Errorf("%q: %s", test.command, err)
+			continue
+		}
+		if strings.Join(words, "\x00") != strings.Join(test.words, "\x00") || len(words) != len(test.words) {
+			t.Errorf("%q: expected %q, got %q", test.command, test.words, words)
+		}
+	}
+}
+
+func TestSplitCommandErrors(t *testing.T) {
+	for command, expected := range map[string]string{
+		`echo 'open`:   "unterminated single quote",
+		`echo "open`:   "unterminated double quote",
+		`echo "open\"`: "unterminated double quote",
+		`echo \`:       "backslash at the end of the command",
+	} {
+		if _, err := splitCommand(command); err == nil || err.Error() != expected {
+			t.Errorf("%q: expected %q, got %v", command, expected, err)
+		}
+	}
+}
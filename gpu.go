@@ -0,0 +1,215 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// NvidiaSMI is the nvidia-smi binary used by the GPU measurements. It
+// is looked up in PATH unless it contains a path.
+var NvidiaSMI = "nvidia-smi"
+
+// nvidiaQuery executes nvidia-smi with a --query-gpu query and returns
+// the non-empty output lines. When index is not negative only the GPU
+// with that index is queried.
+func nvidiaQuery(query string, index int) ([]string, error) {
+	args := []string{"--query-gpu=" + query, "--format=csv,noheader,nounits"}
+	if index >= 0 {
+		args = append(args, "-i", strconv.Itoa(index))
+	}
+	out, err := runCommand(NvidiaSMI, args...)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// gpuCount returns the number of GPUs known to nvidia-smi.
+func gpuCount() (int, error) {
+	lines, err := nvidiaQuery("index", -1)
+	if err != nil {
+		return 0, err
+	}
+	return len(lines), nil
+}
+
+// GPUMemoryFreeMeasurement returns a measurement function reporting
+// the free memory of the GPU with the given index in MiB as reported
+// by nvidia-smi. When the GPU disappeared (for example after a GPU
+// reset) an error is returned for this measurement only.
+func GPUMemoryFreeMeasurement(index int) func() (string, error) {
+	return func() (string, error) {
+		lines, err := nvidiaQuery("memory.free", index)
+		if err != nil {
+			return "", err
+		}
+		if len(lines) != 1 {
+			return "", fmt.Errorf("unexpected nvidia-smi output for GPU %d: %q", index, lines)
+		}
+		if _, err := strconv.ParseUint(lines[0], 10, 64); err != nil {
+			return "", fmt.Errorf("invalid free memory of GPU %d: %q", index, lines[0])
+		}
+		return lines[0], nil
+	}
+}
+
+// NewGPUMemoryFreeSensors creates one sensor per GPU reporting its
+// free memory in MiB as resource gpu<index>_mem (gpu0_mem, gpu1_mem,
+// ...). The number of GPUs is determined once when the sensors are
+// created.
+func NewGPUMemoryFreeSensors() ([]Sensor, error) {
+	count, err := gpuCount()
+	if err != nil {
+		return nil, err
+	}
+	sensors := make([]Sensor, 0, count)
+	for i := 0; i < count; i++ {
+		sensors = append(sensors, NewSensor(fmt.Sprintf("gpu%d_mem", i), GPUMemoryFreeMeasurement(i)))
+	}
+	return sensors, nil
+}
+
+// GPUECCErrorsMeasurement returns a measurement function reporting the
+// cumulative number of ECC errors of the given type of the GPU with
+// the given index since the driver was installed (the aggregate
+// counters of nvidia-smi). An error is returned when the GPU does not
+// support ECC or ECC is disabled.
+func GPUECCErrorsMeasurement(index int, t ECCErrorType) func() (string, error) {
+	query := "ecc.errors.corrected.aggregate.total"
+	if t == ECCUncorrected {
+		query = "ecc.errors.uncorrected.aggregate.total"
+	}
+	return func() (string, error) {
+		lines, err := nvidiaQuery(query, index)
+		if err != nil {
+			return "", err
+		}
+		if len(lines) != 1 {
+			return "", fmt.Errorf("unexpected nvidia-smi output for GPU %d: %q", index, lines)
+		}
+		if _, err := strconv.ParseUint(lines[0], 10, 64); err != nil {
+			return "", fmt.Errorf("no ECC error count for GPU %d: %q", index, lines[0])
+		}
+		return lines[0], nil
+	}
+}
+
+// NewGPUECCErrorsSensor creates a sensor reporting the cumulative
+// number of ECC errors of the given type of the GPU with the given
+// index (see GPUECCErrorsMeasurement) as resource.
+func NewGPUECCErrorsSensor(resource string, index int, t ECCErrorType) Sensor {
+	return NewSensor(resource, GPUECCErrorsMeasurement(index, t))
+}
+
+// gpuIDs returns the UUIDs of all GPUs known to nvidia-smi and a map
+// from their indexes to the UUIDs.
+func gpuIDs() (indexes map[string]string, uuids []string, err error) {
+	lines, err := nvidiaQuery("index,uuid", -1)
+	if err != nil {
+		return nil, nil, err
+	}
+	indexes = make(map[string]string, len(lines))
+	for _, line := range lines {
+		index, uuid, ok := strings.Cut(line, ",")
+		if !ok {
+			return nil, nil, fmt.Errorf("unexpected nvidia-smi output: %q", line)
+		}
+		uuid = strings.TrimSpace(uuid)
+		indexes[strings.TrimSpace(index)] = uuid
+		uuids = append(uuids, uuid)
+	}
+	return indexes, uuids, nil
+}
+
+// countVisibleDevices counts the GPUs selected by a device list like
+// CUDA_VISIBLE_DEVICES. Like CUDA it stops at the first entry which
+// does not name an existing GPU, entries naming the same GPU twice are
+// counted once. UUIDs can be abbreviated to a unique prefix.
+func countVisibleDevices(list string, indexes map[string]string, uuids []string) int {
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		id, ok := indexes[entry]
+		if !ok && (strings.HasPrefix(entry, "GPU-") || strings.HasPrefix(entry, "MIG-")) {
+			for _, uuid := range uuids {
+				if strings.HasPrefix(uuid, entry) {
+					if id != "" {
+						// ambiguous prefix
+						id = ""
+						break
+					}
+					id = uuid
+				}
+			}
+			if id == "" && strings.HasPrefix(entry, "MIG-") {
+				// MIG instances are not listed by --query-gpu
+				id = entry
+			}
+		}
+		if id == "" {
+			break
+		}
+		seen[id] = true
+	}
+	return len(seen)
+}
+
+// VisibleGPUCountMeasurement reports the number of GPUs the jobs of
+// the host can use. When CUDA_VISIBLE_DEVICES is set only the GPUs it
+// lists are counted, with the semantics of CUDA: indexes and UUIDs are
+// accepted and the list ends at the first entry which does not name a
+// GPU, so an empty or invalid list reports 0. Otherwise
+// NVIDIA_VISIBLE_DEVICES of the NVIDIA container runtime is honored,
+// where "all" selects all GPUs and "none", "void" or an empty value
+// none. When neither variable is set all GPUs known to nvidia-smi are
+// counted. An error is returned when nvidia-smi can not be executed,
+// even when a variable selects no GPU.
+func VisibleGPUCountMeasurement() (string, error) {
+	indexes, uuids, err := gpuIDs()
+	if err != nil {
+		return "", err
+	}
+	if list, ok := os.LookupEnv("CUDA_VISIBLE_DEVICES"); ok {
+		return strconv.Itoa(countVisibleDevices(list, indexes, uuids)), nil
+	}
+	if list, ok := os.LookupEnv("NVIDIA_VISIBLE_DEVICES"); ok {
+		switch strings.TrimSpace(list) {
+		case "all":
+			return strconv.Itoa(len(uuids)), nil
+		case "", "none", "void":
+			return "0", nil
+		}
+		return strconv.Itoa(countVisibleDevices(list, indexes, uuids)), nil
+	}
+	return strconv.Itoa(len(uuids)), nil
+}
+
+// NewVisibleGPUCountSensor creates a sensor reporting the number of
+// GPUs visible to jobs as resource (see VisibleGPUCountMeasurement).
+func NewVisibleGPUCountSensor(resource string) Sensor {
+	return NewSensor(resource, VisibleGPUCountMeasurement)
+}
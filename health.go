@@ -0,0 +1,106 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	// DefaultHealthTimeout is the timeout of a health check which is
+	// created without a positive timeout.
+	DefaultHealthTimeout = 5 * time.Second
+	// MaxHealthTimeout is the maximum timeout of a health check so
+	// that a hanging service does not stall the load report.
+	MaxHealthTimeout = 30 * time.Second
+)
+
+// healthTimeout bounds the timeout of a health check.
+func healthTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return DefaultHealthTimeout
+	}
+	if timeout > MaxHealthTimeout {
+		return MaxHealthTimeout
+	}
+	return timeout
+}
+
+// healthValue converts the result of a health check into the value
+// of a BOOL complex.
+func healthValue(healthy bool) string {
+	if healthy {
+		return "1"
+	}
+	return "0"
+}
+
+// TCPHealthMeasurement returns a measurement function which reports
+// "1" when a TCP connection to addr (like "localhost:5432") can be
+// established within timeout and "0" otherwise. A timeout which is
+// not positive is DefaultHealthTimeout, a timeout above
+// MaxHealthTimeout is reduced to it.
+func TCPHealthMeasurement(addr string, timeout time.Duration) func() (string, error) {
+	timeout = healthTimeout(timeout)
+	return func() (string, error) {
+		conn, err := net.DialTimeout("tcp", addr, timeout)
+		if err != nil {
+			return healthValue(false), nil
+		}
+		conn.Close()
+		return healthValue(true), nil
+	}
+}
+
+// HTTPHealthMeasurement returns a measurement function which reports
+// "1" when a GET request of url is answered within timeout with the
+// expected status code and "0" otherwise. An expectedStatus of 0
+// accepts any 2xx status. Redirects are followed within the timeout.
+// The timeout is bounded like the one of TCPHealthMeasurement.
+func HTTPHealthMeasurement(url string, timeout time.Duration, expectedStatus int) func() (string, error) {
+	client := &http.Client{Timeout: healthTimeout(timeout)}
+	return func() (string, error) {
+		resp, err := client.Get(url)
+		if err != nil {
+			return healthValue(false), nil
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+		resp.Body.Close()
+		if expectedStatus == 0 {
+			return healthValue(resp.StatusCode >= 200 && resp.StatusCode < 300), nil
+		}
+		return healthValue(resp.StatusCode == expectedStatus), nil
+	}
+}
+
+// NewHealthSensor creates a sensor which reports the result of a
+// health check like TCPHealthMeasurement or HTTPHealthMeasurement as
+// BOOL resource. When stablePeriod is positive a changed result is
+// only reported after it was stable for that period (see Debounce),
+// so that a single failed check does not make the host unavailable
+// for jobs requesting the resource.
+func NewHealthSensor(resource string, check func() (string, error), stablePeriod time.Duration) Sensor {
+	if stablePeriod > 0 {
+		check = Debounce(check, stablePeriod)
+	}
+	sensor := NewSensor(resource, check)
+	sensor.Type = "BOOL"
+	return sensor
+}
@@ -0,0 +1,103 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import "sync"
+
+// DefaultHookQueueSize is the number of load reports queued for an
+// async report hook when WithAsyncReportHook is called with a queue
+// size of 0 or less.
+const DefaultHookQueueSize = 16
+
+// asyncHook delivers load reports to a hook on its own goroutine.
+type asyncHook struct {
+	hook  func([]Report)
+	queue chan []Report
+	once  sync.Once
+}
+
+// WithAsyncReportHook calls hook with each load report, including the
+// values of shadow sensors, after it was written, for example to push
+// the values to a metrics system over the network. The load reports
+// are queued and hook is called one report after another on a
+// goroutine of its own, which is started with the first report and
+// kept for the lifetime of the process, so a slow or hanging hook
+// never delays the answers to the execd. The queue holds queueSize
+// load reports (see DefaultHookQueueSize). When it is full the oldest
+// queued report is dropped with a warning on stderr; the number of
+// dropped reports is reported as HookDrops by Status. Delivery is
+// therefore at most once: reports are lost when the hook falls behind
+// and reports still queued when the process exits are not delivered.
+// The hook receives a copy of the report it may keep.
+func WithAsyncReportHook(hook func([]Report), queueSize int) Option {
+	return func(ctx *Context) {
+		if queueSize <= 0 {
+			queueSize = DefaultHookQueueSize
+		}
+		ctx.hooks = append(ctx.hooks, &asyncHook{hook: hook, queue: make(chan []Report, queueSize)})
+	}
+}
+
+func (h *asyncHook) deliver() {
+	for report := range h.queue {
+		h.hook(report)
+	}
+}
+
+// enqueue queues the report and returns false when the oldest queued
+// report had to be dropped for it.
+func (h *asyncHook) enqueue(report []Report) bool {
+	h.once.Do(func() { go h.deliver() })
+	dropped := false
+	for {
+		select {
+		case h.queue <- report:
+			return !dropped
+		default:
+		}
+		select {
+		case <-h.queue:
+			dropped = true
+		default:
+			// the hook took the oldest report in the meantime
+		}
+	}
+}
+
+// copyReport returns a copy of the report which does not share any
+// state with the context.
+func copyReport(report []Report) []Report {
+	c := append([]Report(nil), report...)
+	for i := range c {
+		c[i].Labels = copyLabels(c[i].Labels)
+	}
+	return c
+}
+
+// queueHooks queues the load report for all async report hooks.
+func (ctx *Context) queueHooks(report []Report) {
+	for _, h := range ctx.hooks {
+		if h.enqueue(copyReport(report)) {
+			continue
+		}
+		ctx.mutex.Lock()
+		ctx.hookDrops++
+		drops := ctx.hookDrops
+		ctx.mutex.Unlock()
+		ctx.logf("report hook queue is full, dropped the oldest load report (%d dropped so far)", drops)
+	}
+}
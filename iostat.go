@@ -0,0 +1,230 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// counterSampleInterval is the time between the two samples of the
+// first measurement of a counter delta.
+const counterSampleInterval = 250 * time.Millisecond
+
+// sampler derives a value from the difference of two samples of
+// cumulative counters. The first measurement samples twice within
+// counterSampleInterval, each following measurement compares with the
+// sample of the previous one, which covers the load report interval.
+type sampler[T any] struct {
+	sync.Mutex
+	clock   Clock
+	read    func() (T, error)
+	derive  func(previous, current T, elapsed time.Duration) (string, error)
+	last    T
+	sampled time.Time
+	valid   bool
+}
+
+func (s *sampler[T]) measure() (string, error) {
+	s.Lock()
+	defer s.Unlock()
+	if !s.valid {
+		first, err := s.read()
+		if err != nil {
+			return "", err
+		}
+		s.last, s.sampled, s.valid = first, s.clock.Now(), true
+		s.clock.Sleep(counterSampleInterval)
+	}
+	current, err := s.read()
+	if err != nil {
+		s.valid = false
+		return "", err
+	}
+	now := s.clock.Now()
+	value, err := s.derive(s.last, current, now.Sub(s.sampled))
+	s.last, s.sampled = current, now
+	return value, err
+}
+
+// newSampler creates the measurement function of a sampler.
+func newSampler[T any](read func() (T, error),
+	derive func(previous, current T, elapsed time.Duration) (string, error)) func() (string, error) {
+	s := &sampler[T]{clock: currentClock(), read: read, derive: derive}
+	return s.measure
+}
+
+// cpuTimes are the idle, the iowait and the total time of all CPUs in
+// clock ticks from the "cpu" line of /proc/stat.
+type cpuTimes struct {
+	idle   uint64
+	iowait uint64
+	total  uint64
+}
+
+// readCPUTimes reads the accumulated CPU times of /proc/stat. The
+// guest times are already part of the user times and are not added to
+// the total.
+func readCPUTimes() (cpuTimes, error) {
+	content, err := readProcFile("/proc/stat")
+	if err != nil {
+		return cpuTimes{}, err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 || fields[0] != "cpu" {
+			continue
+		}
+		var times cpuTimes
+		for i, field := range fields[1:] {
+			if i >= 8 {
+				break // guest and guest_nice
+			}
+			v, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return cpuTimes{}, fmt.Errorf("invalid cpu line in /proc/stat: %q", line)
+			}
+			times.total += v
+			switch i {
+			case 3:
+				times.idle = v
+			case 4:
+				times.iowait = v
+			}
+		}
+		return times, nil
+	}
+	return cpuTimes{}, errors.New("no cpu line in /proc/stat")
+}
+
+// percent formats part of total as percentage with one digit.
+func percent(part, total float64) string {
+	if total <= 0 {
+		return "0.0"
+	}
+	p := 100 * part / total
+	if p > 100 {
+		p = 100
+	}
+	return strconv.FormatFloat(p, 'f', 1, 64)
+}
+
+// IOWaitMeasurement returns a measurement function reporting the
+// percentage of CPU time all CPUs spent idle waiting for I/O, derived
+// from the cumulative counters of /proc/stat. Like all counter based
+// measurements the first call samples twice within a short period,
+// each following call reports the percentage since the previous call.
+// It is only supported on Linux.
+func IOWaitMeasurement() func() (string, error) {
+	return newSampler(readCPUTimes, ioWaitPercent)
+}
+
+// ioWaitPercent derives the I/O wait percentage from two samples of
+// the CPU times.
+func ioWaitPercent(previous, current cpuTimes, _ time.Duration) (string, error) {
+	if current.total < previous.total || current.iowait < previous.iowait {
+		// the kernel counters are not monotonic when CPUs go offline
+		return percent(0, 0), nil
+	}
+	return percent(float64(current.iowait-previous.iowait), float64(current.total-previous.total)), nil
+}
+
+// NewIOWaitSensor creates a sensor reporting the I/O wait percentage
+// (see IOWaitMeasurement) as resource.
+func NewIOWaitSensor(resource string) Sensor {
+	return NewSensor(resource, IOWaitMeasurement())
+}
+
+// CPUUtilizationMeasurement returns a measurement function reporting
+// the percentage of time all CPUs of the host were busy (100 minus the
+// idle percentage) as value from 0 to 100, derived from the cumulative
+// counters of /proc/stat. Unlike the load average it does not count
+// waiting processes, so it is a true busy percentage. Time spent
+// waiting for I/O counts as idle (see IOWaitMeasurement). It samples
+// like IOWaitMeasurement: the first call samples twice and therefore
+// delays its load report by a quarter of a second, each following
+// call reports the utilization since the previous call without any
+// delay. An error is returned when /proc/stat can not be read. It is
+// only supported on Linux.
+func CPUUtilizationMeasurement() func() (string, error) {
+	return newSampler(readCPUTimes, func(previous, current cpuTimes, _ time.Duration) (string, error) {
+		previousIdle, currentIdle := previous.idle+previous.iowait, current.idle+current.iowait
+		if current.total < previous.total || currentIdle < previousIdle {
+			return percent(0, 0), nil
+		}
+		total := current.total - previous.total
+		return percent(float64(total-(currentIdle-previousIdle)), float64(total)), nil
+	})
+}
+
+// NewCPUUtilizationSensor creates a sensor reporting the CPU
+// utilization percentage (see CPUUtilizationMeasurement) as resource.
+func NewCPUUtilizationSensor(resource string) Sensor {
+	return NewSensor(resource, CPUUtilizationMeasurement())
+}
+
+// readIOTicks reads the milliseconds the given block device spent
+// doing I/O (io_ticks, the 10th statistics field) from /proc/diskstats.
+func readIOTicks(device string) (uint64, error) {
+	content, err := readProcFile("/proc/diskstats")
+	if err != nil {
+		return 0, err
+	}
+	device = strings.TrimPrefix(device, "/dev/")
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 13 || fields[2] != device {
+			continue
+		}
+		ticks, err := strconv.ParseUint(fields[12], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid statistics of %s in /proc/diskstats: %q", device, line)
+		}
+		return ticks, nil
+	}
+	return 0, fmt.Errorf("no block device %s in /proc/diskstats", device)
+}
+
+// DiskBusyMeasurement returns a measurement function reporting the
+// percentage of time the block device (like "sda" or "/dev/nvme0n1")
+// was busy with I/O, derived from the cumulative io_ticks counter of
+// /proc/diskstats. It samples like IOWaitMeasurement. An error is
+// returned when the device does not exist. It is only supported on
+// Linux.
+func DiskBusyMeasurement(device string) func() (string, error) {
+	read := func() (uint64, error) { return readIOTicks(device) }
+	return newSampler(read, busyPercent)
+}
+
+// busyPercent derives the busy percentage of a device from two samples
+// of its io_ticks counter in milliseconds.
+func busyPercent(previous, current uint64, elapsed time.Duration) (string, error) {
+	if current < previous {
+		return percent(0, 0), nil
+	}
+	return percent(float64(current-previous), float64(elapsed.Milliseconds())), nil
+}
+
+// NewDiskBusySensor creates a sensor reporting the busy percentage of
+// the block device (see DiskBusyMeasurement) as resource.
+func NewDiskBusySensor(resource, device string) Sensor {
+	return NewSensor(resource, DiskBusyMeasurement(device))
+}
@@ -0,0 +1,107 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// measureAsync calls measure in a goroutine, so that its first call
+// can sleep on a FakeClock.
+func measureAsync(measure func() (string, error)) <-chan string {
+	result := make(chan string, 1)
+	go func() {
+		value, err := measure()
+		if err != nil {
+			value = "error: " + err.Error()
+		}
+		result <- value
+	}()
+	return result
+}
+
+func TestSampler(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	SetDefaultClock(clock)
+	t.Cleanup(func() { SetDefaultClock(nil) })
+	ticks := []uint64{0}
+	var readErr error
+	reads := 0
+	measure := newSampler(func() (uint64, error) {
+		if readErr != nil {
+			return 0, readErr
+		}
+		reads++
+		return ticks[len(ticks)-1], nil
+	}, busyPercent)
+	result := measureAsync(measure)
+	// the first call samples twice within counterSampleInterval
+	clock.BlockUntil(1)
+	ticks = append(ticks, 125)
+	clock.Advance(counterSampleInterval)
+	if value := <-result; value != "50.0" || reads != 2 {
+		t.Errorf("first call: expected 50.0 after 2 reads, got %q after %d", value, reads)
+	}
+	steps := []struct {
+		advance time.Duration
+		ticks   uint64
+		value   string
+	}{
+		{10 * time.Second, 125 + 2500, "25.0"},
+		{10 * time.Second, 100, "0.0"},      // the counter went backwards
+		{0, 5000, "0.0"},                    // no time elapsed
+		{time.Second, 5000 + 2000, "100.0"}, // capped at 100 percent
+	}
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		ticks = append(ticks, step.ticks)
+		if value, err := measure(); err != nil || value != step.value {
+			t.Errorf("step %d: expected %q, got %q, %v", i, step.value, value, err)
+		}
+	}
+	readErr = errors.New("no such device")
+	if _, err := measure(); err == nil {
+		t.Error("the read error was not returned")
+	}
+	readErr = nil
+	reads = 0
+	result = measureAsync(measure)
+	clock.BlockUntil(1)
+	clock.Advance(counterSampleInterval)
+	if value := <-result; reads != 2 {
+		t.Errorf("expected two samples after a read error, got %d reads and %q", reads, value)
+	}
+}
+
+func TestIOWaitPercent(t *testing.T) {
+	tests := []struct {
+		previous, current cpuTimes
+		value             string
+	}{
+		{cpuTimes{iowait: 10, total: 1000}, cpuTimes{iowait: 60, total: 1500}, "10.0"},
+		{cpuTimes{iowait: 10, total: 1000}, cpuTimes{iowait: 10, total: 1000}, "0.0"},
+		{cpuTimes{iowait: 10, total: 1000}, cpuTimes{iowait: 5, total: 1500}, "0.0"},
+		{cpuTimes{iowait: 10, total: 1000}, cpuTimes{iowait: 20, total: 900}, "0.0"},
+	}
+	for i, test := range tests {
+		if value, err := ioWaitPercent(test.previous, test.current, time.Second); err != nil || value != test.value {
+			t.Errorf("test %d: expected %q, got %q, %v", i, test.value, value, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// countQstatJobs returns the number of job lines of the default qstat
+// output. Each line after the header starts with the numeric job id;
+// every running task of an array job has a line of its own.
+func countQstatJobs(output string) int {
+	jobs := 0
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if _, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+			jobs++
+		}
+	}
+	return jobs
+}
+
+// RunningJobsMeasurement returns a measurement function reporting the
+// number of jobs of all users running on the local host as integer, as
+// seen by the qmaster. It executes qstat -s r -u * -l hostname=<host>
+// of the installation in SGE_ROOT ($SGE_ROOT/bin/<arch>/qstat, see
+// Arch) with the local host name (see LocalHostname). Each running
+// task of an array job counts as a job, a parallel job counts once per
+// queue instance of the host it is running in. Since every call
+// queries the qmaster, the sensor should have an Interval of several
+// load reports on large clusters. When qstat fails, for example on a
+// host which is not a submit host or while the qmaster is not
+// reachable, an error is returned and no value is reported in that
+// load report.
+func RunningJobsMeasurement() func() (string, error) {
+	return func() (string, error) {
+		d := defaultDetector()
+		host, err := d.Hostname()
+		if err != nil {
+			return "", err
+		}
+		arch, err := d.Arch()
+		if err != nil {
+			return "", err
+		}
+		out, err := runCommandWith(d.runner, filepath.Join(d.root, "bin", arch, "qstat"),
+			"-s", "r", "-u", "*", "-l", "hostname="+host)
+		if err != nil {
+			return "", fmt.Errorf("can not count running jobs: %w", err)
+		}
+		return strconv.Itoa(countQstatJobs(out)), nil
+	}
+}
+
+// NewRunningJobsSensor creates a sensor reporting the number of jobs
+// running on the local host as resource (see RunningJobsMeasurement).
+func NewRunningJobsSensor(resource string) Sensor {
+	sensor := NewSensor(resource, RunningJobsMeasurement())
+	sensor.Type = "INT"
+	return sensor
+}
@@ -0,0 +1,126 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ArchPlaceholder is replaced by the Grid Engine architecture (see
+// Arch) in the paths of a Layout.
+const ArchPlaceholder = "<arch>"
+
+// Layout describes where the arch script and the gethostname binary
+// are located in a Grid Engine installation. Relative paths are
+// relative to SGE_ROOT, absolute paths are used as they are, for
+// example for packaged installations which place the binaries outside
+// of SGE_ROOT. ArchPlaceholder in HostnameBinary is replaced by the
+// architecture. Empty paths are taken from UGELayout.
+type Layout struct {
+	// ArchScript is the script printing the architecture string.
+	ArchScript string
+	// HostnameBinary is the binary printing the Grid Engine host name
+	// when called with -name.
+	HostnameBinary string
+}
+
+// UGELayout is the layout of Univa Grid Engine installations, which
+// is shared by the standard installations of Sun and Oracle Grid
+// Engine and Son of Grid Engine.
+var UGELayout = Layout{
+	ArchScript:     filepath.Join("util", "arch"),
+	HostnameBinary: filepath.Join("utilbin", ArchPlaceholder, "gethostname"),
+}
+
+// DefaultLayout is the layout used by Arch and LocalHostname. The
+// environment variables LOADSENSOR_ARCH_SCRIPT and
+// LOADSENSOR_GETHOSTNAME override its paths, so that the binaries of
+// an installation with a different layout can be configured without
+// changing the load sensor. Changing DefaultLayout or the environment
+// variables discards the cached architecture and host name.
+// DefaultLayout is read without synchronization and must only be set
+// before Run is called.
+var DefaultLayout = UGELayout
+
+// Environment variables overriding the paths of DefaultLayout.
+const (
+	ArchScriptEnv     = "LOADSENSOR_ARCH_SCRIPT"
+	HostnameBinaryEnv = "LOADSENSOR_GETHOSTNAME"
+)
+
+// currentLayout returns DefaultLayout with the overrides of the
+// environment.
+func currentLayout() Layout {
+	l := DefaultLayout
+	if path := os.Getenv(ArchScriptEnv); path != "" {
+		l.ArchScript = path
+	}
+	if path := os.Getenv(HostnameBinaryEnv); path != "" {
+		l.HostnameBinary = path
+	}
+	return l.withDefaults()
+}
+
+// withDefaults replaces empty paths of l by the paths of UGELayout.
+func (l Layout) withDefaults() Layout {
+	if l.ArchScript == "" {
+		l.ArchScript = UGELayout.ArchScript
+	}
+	if l.HostnameBinary == "" {
+		l.HostnameBinary = UGELayout.HostnameBinary
+	}
+	return l
+}
+
+// layoutPath returns path relative to the installation in root.
+func layoutPath(root, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(root, path)
+}
+
+// archScript returns the path of the arch script of the installation
+// in root.
+func (l Layout) archScript(root string) string {
+	return layoutPath(root, l.ArchScript)
+}
+
+// hostnameBinary returns the path of the gethostname binary of the
+// installation in root for the given architecture.
+func (l Layout) hostnameBinary(root, arch string) string {
+	return layoutPath(root, strings.ReplaceAll(l.HostnameBinary, ArchPlaceholder, arch))
+}
+
+// findHostnameBinary looks for the gethostname binary in all
+// architecture directories of the installation in root. Older Sun Grid
+// Engine installations name the directories of the binaries like
+// lx24-amd64 while the arch script of a later update reports lx-amd64,
+// so the binary is not found with the architecture string. The binary
+// is only returned when exactly one architecture directory contains it.
+func (l Layout) findHostnameBinary(root string) (string, bool) {
+	if !strings.Contains(l.HostnameBinary, ArchPlaceholder) {
+		return "", false
+	}
+	matches, err := filepath.Glob(l.hostnameBinary(root, "*"))
+	if err != nil || len(matches) != 1 {
+		return "", false
+	}
+	return matches[0], true
+}
@@ -0,0 +1,85 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LicenseCacheTTL is the time the free token count of a license
+// sensor is cached before the license server is queried again.
+// Changes only affect license sensors created afterwards.
+var LicenseCacheTTL = 2 * time.Minute
+
+// lmstatUsage matches the usage line lmstat prints per feature like
+// "Users of feature:  (Total of 10 licenses issued;  Total of 3 licenses in use)"
+var lmstatUsage = regexp.MustCompile(`Users of ([^:]+):\s+\(Total of (\d+) licenses? issued;\s+Total of (\d+) licenses? in use\)`)
+
+// parseLmstat returns the number of free license tokens of the given
+// feature found in the output of lmstat.
+func parseLmstat(output, feature string) (int, error) {
+	for _, m := range lmstatUsage.FindAllStringSubmatch(output, -1) {
+		if m[1] != feature {
+			continue
+		}
+		issued, err := strconv.Atoi(m[2])
+		if err != nil {
+			return 0, err
+		}
+		inUse, err := strconv.Atoi(m[3])
+		if err != nil {
+			return 0, err
+		}
+		if inUse > issued {
+			return 0, nil
+		}
+		return issued - inUse, nil
+	}
+	return 0, fmt.Errorf("no usage information for license feature %s in lmstat output: %s",
+		feature, strings.TrimSpace(output))
+}
+
+// LicenseMeasurement returns a measurement function which reports
+// the number of free tokens of a FlexLM license feature by executing
+// "lmutil lmstat -f feature" with the runner set by SetDefaultRunner.
+// When the license server can not be reached an error is returned so
+// that no value is reported.
+func LicenseMeasurement(feature, lmutilPath string) func() (string, error) {
+	return func() (string, error) {
+		out, err := runCommand(lmutilPath, "lmstat", "-f", feature)
+		if err != nil {
+			return "", fmt.Errorf("lmstat for license feature %s failed: %w", feature, err)
+		}
+		free, err := parseLmstat(out, feature)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(free), nil
+	}
+}
+
+// NewLicenseSensor creates a sensor which reports the free tokens of
+// the given FlexLM license feature as resource. The result is cached
+// for LicenseCacheTTL since license servers should not be polled in
+// each load report interval.
+func NewLicenseSensor(resource, feature string, lmutilPath string) Sensor {
+	return newCachedSensor(resource, LicenseMeasurement(feature, lmutilPath), LicenseCacheTTL)
+}
@@ -0,0 +1,83 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import "testing"
+
+// lmstatOutput is output in the format of "lmutil lmstat -a" of a
+// FlexLM server.
+const lmstatOutput = `lmutil - Copyright (c) 1989-2019 Flexera. All Rights Reserved.
+Flexible License Manager status on Mon 1/4/2016 10:02
+
+[Detecting lmgrd processes...]
+License server status: 27000@licsrv
+    License file(s) on licsrv: /opt/flexlm/licenses/license.dat:
+
+   licsrv: license server UP (MASTER) v11.16.4
+
+Vendor daemon status (on licsrv):
+
+     MLM: UP v11.16.4
+Feature usage info:
+
+Users of MATLAB:  (Total of 10 licenses issued;  Total of 3 licenses in use)
+
+  "MATLAB" v44, vendor: MLM, expiry: 01-jan-0000
+  floating license
+
+    alice node1 /dev/pts/0 (v44) (licsrv/27000 101), start Mon 1/4 9:12
+    bob node2 /dev/pts/1 (v44) (licsrv/27000 202), start Mon 1/4 9:30
+    carol node3 /dev/pts/2 (v44) (licsrv/27000 303), start Mon 1/4 9:58
+
+Users of Simulink:  (Total of 5 licenses issued;  Total of 0 licenses in use)
+
+Users of Signal_Toolbox:  (Total of 1 license issued;  Total of 1 license in use)
+
+  "Signal_Toolbox" v44, vendor: MLM, expiry: 01-jan-0000
+  floating license
+
+    alice node1 /dev/pts/0 (v44) (licsrv/27000 404), start Mon 1/4 9:13
+
+Users of Borrowed:  (Total of 2 licenses issued;  Total of 4 licenses in use)
+
+Users of Node_Locked:  (Uncounted, node-locked)
+`
+
+func TestParseLmstat(t *testing.T) {
+	tests := []struct {
+		feature string
+		free    int
+		valid   bool
+	}{
+		{"MATLAB", 7, true},
+		{"Simulink", 5, true},
+		{"Signal_Toolbox", 0, true},
+		{"Borrowed", 0, true},
+		{"Node_Locked", 0, false},
+		{"Signal", 0, false},
+		{"Unknown", 0, false},
+	}
+	for _, test := range tests {
+		free, err := parseLmstat(lmstatOutput, test.feature)
+		if (err == nil) != test.valid || free != test.free {
+			t.Errorf("%s: expected %d free tokens (valid %v), got %d, %v", test.feature, test.free, test.valid, free, err)
+		}
+	}
+	if _, err := parseLmstat("", "MATLAB"); err == nil {
+		t.Error("no error for empty lmstat output")
+	}
+}
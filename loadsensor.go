@@ -14,111 +14,740 @@
    limitations under the License.
 */
 
-// Package loadsensor implements helper functions for writing an
-// Univa Grid Engine loadsensor in Go.
+// Package loadsensor implements helper functions for writing a Grid
+// Engine loadsensor in Go. It is written for Univa Grid Engine and
+// works with the other Grid Engine lineages, like Sun and Oracle Grid
+// Engine and Son of Grid Engine, as well. Installations whose arch
+// script or gethostname binary is not at the default location are
+// supported with DefaultLayout and its environment variables.
 package loadsensor
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrSGERootUnset is returned when the SGE_ROOT environment
+	// variable, which points to the Grid Engine installation, is not
+	// set. Sensors depending on Grid Engine binaries can not work
+	// without it.
+	ErrSGERootUnset = errors.New("SGE_ROOT is not set")
+	// ErrArchDetection is returned when the Grid Engine architecture
+	// could not be determined by the arch script.
+	ErrArchDetection = errors.New("architecture detection failed")
+	// ErrHostnameResolution is returned when the local host name could
+	// not be determined by the Grid Engine gethostname binary.
+	ErrHostnameResolution = errors.New("hostname resolution failed")
 )
 
 // Arch executes the Univa Grid Engine architecture detection
 // script once and returns the correct UGE architecture string.
 // This is required to create the correct path to the UGE binaries.
-// The result is cached since the archtecture string does not change
-// during the runtime of the load sensor.
+// The script is located with DefaultLayout. The result is cached
+// since the architecture string does not change during the runtime of
+// the load sensor.
+//
+// Errors wrap ErrArchDetection and ErrSGERootUnset when SGE_ROOT is
+// not set.
 func Arch() (string, error) {
-	path := fmt.Sprintf("%s/util/arch", os.Getenv("SGE_ROOT"))
-	arch, err := exec.Command(path).Output()
-	return strings.TrimSpace(string(arch)), err
+	return defaultDetector().Arch()
 }
 
 // LocalHostname returns the local hostname determined by
-// the Univa Grid Engine gethostname binary. Using this hostname
+// the Univa Grid Engine gethostname binary (see DefaultLayout and
+// Detector.Hostname). Using this hostname
 // prevents issues when the host is known by multiple hostnames.
 // You should not rely on the OS hostname call.
+//
+// Errors wrap ErrHostnameResolution and, when the architecture could
+// not be determined, the errors returned by Arch.
 func LocalHostname() (string, error) {
-	arch, err := Arch()
-	if err != nil {
-		return "", err
+	return defaultDetector().Hostname()
+}
+
+// DefaultCell is the Grid Engine cell used when SGE_CELL is not set.
+const DefaultCell = "default"
+
+// Cell returns the Grid Engine cell the host is serving, which is the
+// value of the SGE_CELL environment variable or DefaultCell when it is
+// not set, like the Grid Engine binaries do. An error is returned when
+// SGE_CELL is not a valid directory name of $SGE_ROOT.
+func Cell() (string, error) {
+	cell := strings.TrimSpace(os.Getenv("SGE_CELL"))
+	if cell == "" {
+		return DefaultCell, nil
 	}
-	path := fmt.Sprintf("%s/utilbin/%s/gethostname", os.Getenv("SGE_ROOT"), arch)
-	hostname, errExec := exec.Command(path, "-name").Output()
-	return strings.TrimSpace(string(hostname)), errExec
+	if cell == "." || cell == ".." || strings.ContainsAny(cell, "/\\") {
+		return "", fmt.Errorf("invalid SGE_CELL %q", cell)
+	}
+	return cell, nil
+}
+
+// NewCellSensor creates a sensor reporting the Grid Engine cell of the
+// host (see Cell) as resource, which is meant for a STRING complex
+// showing which cell a host serves in multi-cell setups.
+func NewCellSensor(resource string) Sensor {
+	return NewStaticSensor(resource, Cell)
 }
 
+// ErrSkip can be returned by a measurement function which has nothing
+// to report in the current load report. The value is omitted from the
+// report without logging an error. Note that "0", "0.0" and negative
+// values are valid measurements which are always reported.
+var ErrSkip = errors.New("no value to report")
+
+// ErrClear can be returned by a measurement function to remove a
+// previously reported value, for example when a transient resource
+// disappeared. The load sensor protocol has no sentinel value for
+// this, so with the default LineProtocol the value is omitted from the
+// load report exactly like with ErrSkip and Grid Engine keeps the
+// previous value until it expires. A ProtocolWriter can write an
+// explicit removal instead. Unlike ErrSkip, ErrClear also discards any
+// value which would otherwise be reported again (see Sensor.Interval)
+// and clears the value in the Status of the sensor.
+var ErrClear = errors.New("value cleared")
+
 // Sensor is a data structure which contains all functions required for
-// performing one load measurement.
+// performing one load measurement. A measurement function returning
+// ErrSkip or an empty string reports no value for the resource in the
+// current load report. A value like "NaN" or "+Inf", which Grid Engine
+// can not parse, is treated as failed measurement (see ErrNotFinite),
+// as well as numbers rejected by ValidateTypedValue like "1.2e+06".
+//
+// The ResourceNameFunction must return the same name in every load
+// report: the name is the Grid Engine complex the value belongs to,
+// which is configured once, and the state of a sensor (like
+// ReportOnChange and the Status) is kept per sensor. Dynamic data
+// belongs into the measured value. A changed resource name is logged
+// as warning.
 type Sensor struct {
 	HostNameFunction     func() (string, error)
 	ResourceNameFunction func() (string, error)
 	MeasurementFunction  func() (string, error)
+	// MeasurementContextFunction can be set instead of the
+	// MeasurementFunction for measurements which should be cancelled
+	// when the cycle is aborted (see FailFast). When both are set
+	// the MeasurementContextFunction is used.
+	MeasurementContextFunction func(context.Context) (string, error)
+	// Interval is the minimum time between two measurements of the
+	// sensor. Grid Engine triggers a load report in each load report
+	// interval of the execd. When the Interval of the sensor has not
+	// elapsed since its last successful measurement, the last value is
+	// reported again without executing the measurement, so the value
+	// stays present in every load report. The Interval is therefore
+	// effectively rounded up to a multiple of the load report interval.
+	// When a measurement fails no value is reported in that load report
+	// (Grid Engine keeps the previous value until it expires) and the
+	// sensor is measured again in the next load report. Zero measures
+	// the sensor in every load report.
+	Interval time.Duration
+	// HostAllowlist restricts the sensor to the listed hosts. When it
+	// is not empty the sensor is only measured and reported when the
+	// local host name (see LocalHostname) matches one of the patterns.
+	// Patterns are matched case insensitive against the complete host
+	// name using the syntax of path.Match: "*" matches any sequence of
+	// characters, "?" any single character and "[a-c]" a character
+	// range. A prefix match is written as "node*", an exact match is a
+	// pattern without wildcards. When the local host name can not be
+	// determined the sensor fails.
+	HostAllowlist []string
+	// ReportOnChange omits the value from the load report when it is
+	// unchanged since it was last reported. Grid Engine keeps the
+	// previous value of a load value which is missing from a load
+	// report only until it expires, hence an unchanged value is
+	// reported again at least every MaxStaleness to keep it alive. A
+	// value only counts as reported when it was written successfully,
+	// and a load report without a value of the sensor (because it
+	// failed, was skipped or did not fit into WithMaxReportSize) makes
+	// its next value be reported in any case. Use this only when the
+	// Grid Engine setup does not rely on each load report containing the
+	// value. The default is to report the value in every load report.
+	ReportOnChange bool
+	// MaxStaleness is the maximum time an unchanged value is omitted
+	// when ReportOnChange is set. Zero means DefaultMaxStaleness.
+	MaxStaleness time.Duration
+	// Unit and Type optionally document the value of the sensor, for
+	// example "bytes" and "MEMORY" (the type of the Grid Engine complex,
+	// see complex(5)). They are shown in the Status of the sensor to
+	// allow a comparison with the complex configuration and are never
+	// part of the load report. A sensor with the Type INT fails when it
+	// measures a value which is not an integer, like "1.5", a sensor
+	// with the Type INT, DOUBLE or MEMORY when the value contains a
+	// comma, like "1,5" (see ValidateTypedValue).
+	Unit string
+	Type string
+	// Precision optionally sets the number of digits after the decimal
+	// point of numeric values of the sensor, like 2 for a load average
+	// or 0 for a temperature reported as integer (see Digits). Values
+	// are rounded to the nearest number with that many digits, halfway
+	// values away from zero: 0.125 becomes "0.13" with 2 digits and
+	// -2.5 becomes "-3" with 0 digits. The value is rounded as written
+	// in its shortest decimal form, so 1.005 becomes "1.01" although the
+	// nearest float64 is slightly smaller. A negative precision uses the
+	// smallest number of digits which represent the value exactly,
+	// which also removes exponents like in "1.2e+06". Values which are
+	// not numbers are reported unchanged. A sensor with a Precision is
+	// not formatted by the value formatter of the context (see
+	// WithValueFormatter), the per sensor precision wins. Nil, the
+	// default, reports the values as measured.
+	Precision *int
+	// ValuePattern optionally guards against malformed output of
+	// measurements, like a script writing "ERROR: ..." to stdout
+	// instead of a value. The value, after leading and trailing
+	// whitespace was removed (see WithTrimSpace) and before the value
+	// formatter is applied, must match the pattern, otherwise the
+	// measurement fails and no value is reported. The pattern is not
+	// anchored, use "^[0-9]+$" to match the complete value. It applies
+	// to each value of a ReportsFunction as well.
+	ValuePattern *regexp.Regexp
+	// Labels are arbitrary key value pairs like the data center or the
+	// team owning the sensor. They are passed to the Report values, the
+	// Status and the report sinks for integrations with other systems
+	// but never written to Grid Engine. The map must not be modified
+	// after the context was created.
+	Labels map[string]string
+	// Profiles restricts the sensor to the listed profiles, like
+	// "prod" or a node class, when one binary serves several
+	// deployments. The sensor is only measured when the active profile
+	// of the context (see WithProfile and ProfileEnv) is one of them.
+	// An empty list measures the sensor in all profiles, as does a
+	// context without active profile.
+	Profiles []string
+	// Shadow runs the sensor in each load report without ever writing
+	// its value to Grid Engine, for example to validate a new complex
+	// against real load before it goes live. The value of a shadow
+	// sensor is logged (see WithLogOutput) and passed to the Status and
+	// the report sinks marked as shadow value (see Report.Shadow), but
+	// it is never part of the load report and therefore never affects
+	// scheduling.
+	Shadow bool
+	// ReportsFunction can be set instead of the HostNameFunction, the
+	// ResourceNameFunction and the measurement function for a sensor
+	// which reports values for several hosts at once (see
+	// NewMultiHostSensor). All returned values are written in the same
+	// load report. Each value is checked like the value of a single
+	// sensor: invalid values are dropped and logged as failure of the
+	// sensor while the remaining values are still reported, also with
+	// FailFast since such a partial failure does not abort the load
+	// report. Of several values of the same host and resource only the
+	// first is reported, a different value of a later one is logged as
+	// failure as well. ReportOnChange is not supported and the values
+	// are not available to ReportedValue.
+	//
+	// Grid Engine accepts load values for other hosts from a load
+	// sensor, but the execd forwards them without checking whether the
+	// host exists or is served by another execd. When the hosts run
+	// their own execd with a load sensor, both load sensors overwrite
+	// each other's values, so each host and resource should be reported
+	// by exactly one load sensor of the cluster. Values of unknown
+	// hosts are dropped by the qmaster.
+	ReportsFunction func(context.Context) ([]Report, error)
+
+	// spec is the specification the sensor was created from (see
+	// ParseSensorFlag and ExportConfig)
+	spec string
+	// options are the options of the context the sensor was merged
+	// from (see Merge), nil for the options of its own context
+	options *sensorOptions
+}
+
+// DefaultMaxStaleness is the time after which an unchanged value of a
+// sensor with ReportOnChange is reported again when the sensor has no
+// MaxStaleness set. It is shorter than the typical load value expiry
+// of Grid Engine.
+const DefaultMaxStaleness = 2 * time.Minute
+
+// NewSensor creates a Sensor which reports the result of the given
+// measurement function as the value of the given resource for the
+// local host (see LocalHostname).
+func NewSensor(resource string, measurement func() (string, error)) Sensor {
+	return Sensor{
+		HostNameFunction:     LocalHostname,
+		ResourceNameFunction: func() (string, error) { return resource, nil },
+		MeasurementFunction:  measurement,
+	}
 }
 
 // Context of the whole load sensor. Contains all sensors which make the
 // individual measurements.
 type Context struct {
 	sensors []Sensor
+	config
+
+	// mutex protects the runtime state below which is read by Status
+	mutex      sync.Mutex
+	started    time.Time
+	cycles     uint64
+	lastCycle  time.Time
+	lastReport []Report
+	stats      []SensorStatus
+	states     []sensorState
+	// reportOffset is the index of the first value of the next load
+	// report when reports are split (see WithMaxReportSize)
+	reportOffset int
+	// lastCycleDuration is the time the previous cycle took
+	lastCycleDuration time.Duration
+	// localHost is the cached local host name of the built-in values
+	localHost string
+	// shutdown contains the functions registered with OnShutdown
+	shutdown []func() error
+	// restarts is the number of restarts read from the restart counter
+	restarts uint64
+	// reloaded contains the sensors to use from the next load report
+	// on (see WithReload)
+	reloaded []Sensor
+	// latest contains the results of the background measurements
+	// while they are running (see WithBackgroundMeasurement)
+	latest []measurement
+	// paused and pauseMode are set by Pause
+	paused    bool
+	pauseMode MaintenanceMode
+	// hookDrops counts the load reports dropped by full queues of the
+	// async report hooks
+	hookDrops uint64
+}
+
+// sensorState is the internal per sensor state of a context.
+type sensorState struct {
+	// lastRun is the start of the cycle of the last measurement
+	lastRun time.Time
+	// last is the result of the last successful measurement
+	last  measurement
+	valid bool
+	// emitted is the value last written when ReportOnChange is set
+	emitted   Report
+	emittedAt time.Time
+	// loggedError is the error last logged at loggedAt, suppressed
+	// counts its repetitions since then (see WithErrorLogInterval)
+	loggedError string
+	loggedAt    time.Time
+	suppressed  uint64
+}
+
+// config contains the settings of a context which are changed by
+// options.
+type config struct {
+	clock           Clock
+	parallelism     int
+	defaultInterval time.Duration
+	errorPolicy     ErrorPolicy
+	lockFile        string
+	sinks           []io.Writer
+	sinkFormat      SinkFormat
+	hooks           []*asyncHook
+
+	valueFormatter  func(string) string
+	readinessWindow time.Duration
+	hostTransform   func(string) string
+	maxReportSize   int
+	lineEnding      string
+	protocol        ProtocolWriter
+	groupByHost     bool
+
+	cycleDurationResource string
+	heartbeatResource     string
+	heartbeatEvery        int
+	background            bool
+	emitOnStartup         bool
+	maxCycles             int
+	eofGracePeriod        time.Duration
+	startupDetection      time.Duration
+	restartFile           string
+	restartsResource      string
+	uptimeResource        string
+	catchUp               time.Duration
+
+	input          io.Reader
+	output         io.Writer
+	outputLock     sync.Locker
+	logOutput      io.Writer
+	resourcePrefix string
+	keepSpace      bool
+	profile        string
+	reload         func() ([]Sensor, error)
+
+	errorLogInterval time.Duration
+	errorSuffix      string
+	staleThreshold   time.Duration
+	maxValueAge      time.Duration
+	finalReport      FinalReport
+	maintenanceCheck func() bool
+	maintenanceMode  MaintenanceMode
+	drainValues      map[string]string
+}
+
+// newSensorStatus creates the initial Status of the given sensors.
+func newSensorStatus(s []Sensor) []SensorStatus {
+	stats := make([]SensorStatus, len(s))
+	for i := range s {
+		stats[i].Unit, stats[i].Type = s[i].Unit, s[i].Type
+		stats[i].Labels = s[i].Labels
+	}
+	return stats
+}
+
+// newContext creates a context with the default configuration.
+func newContext(s []Sensor) *Context {
+	clock := currentClock()
+	ctx := &Context{
+		sensors: s,
+		config: config{
+			clock:            clock,
+			parallelism:      1,
+			readinessWindow:  DefaultReadinessWindow,
+			errorLogInterval: DefaultErrorLogInterval,
+			lineEnding:       "\n",
+			profile:          os.Getenv(ProfileEnv),
+		},
+		started: clock.Now(),
+		stats:   newSensorStatus(s),
+		states:  make([]sensorState, len(s)),
+	}
+	ctx.checkProfile()
+	return ctx
+}
+
+// logf writes a diagnostic message to stderr (see WithLogOutput).
+// Stdout is reserved for the load sensor protocol.
+func (ctx *Context) logf(format string, a ...interface{}) {
+	out := ctx.logOutput
+	if out == nil {
+		out = os.Stderr
+	}
+	fmt.Fprintf(out, format+"\n", a...)
+}
+
+// validateSensor checks that all required functions of a sensor are
+// set and that its resource name is valid. All missing functions are
+// listed in the error.
+func validateSensor(s Sensor) error {
+	if s.ReportsFunction != nil {
+		return nil
+	}
+	var missing []string
+	if s.HostNameFunction == nil {
+		missing = append(missing, "HostNameFunction")
+	}
+	if s.ResourceNameFunction == nil {
+		missing = append(missing, "ResourceNameFunction")
+	}
+	if s.MeasurementFunction == nil && s.MeasurementContextFunction == nil {
+		missing = append(missing, "MeasurementFunction")
+	}
+	switch len(missing) {
+	case 0:
+		return validateResource(s)
+	case 1:
+		return fmt.Errorf("%s is not set", missing[0])
+	}
+	return fmt.Errorf("%s are not set", strings.Join(missing, ", "))
+}
+
+// validateResource checks the resource name of a sensor when its
+// ResourceNameFunction already returns one. Names which can only be
+// determined later are checked in each load report.
+func validateResource(s Sensor) error {
+	resource, err := s.ResourceNameFunction()
+	if err != nil {
+		return nil
+	}
+	return ValidateResourceName(strings.TrimSpace(resource))
 }
 
 // Create initializes a new load sensor context with the given sensors.
+// When sensors are invalid no context is returned. The error then lists
+// the problems of all invalid sensors, one per line prefixed with the
+// index of the sensor like "sensor 2: HostNameFunction is not set".
+// Resource names are checked with ValidateResourceName, for example
+// for their maximum length. Names which the ResourceNameFunction can
+// not return yet are checked in each load report instead, an invalid
+// name is then an error of the sensor.
 func Create(s []Sensor) (*Context, error) {
+	var errs []error
 	for i := range s {
-		if s[i].HostNameFunction == nil {
-			return nil, errors.New("HostNameFunction is not set")
-		}
-		if s[i].ResourceNameFunction == nil {
-			return nil, errors.New("ResourceNameFunction is not set")
+		if err := validateSensor(s[i]); err != nil {
+			errs = append(errs, fmt.Errorf("sensor %d: %w", i, err))
 		}
-		if s[i].MeasurementFunction == nil {
-			return nil, errors.New("MeasurementFunction is not set")
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return newContext(s), nil
+}
+
+// CreateWithOptions initializes a new load sensor context with the
+// given sensors like Create and configures it with the given options
+// in one step, which is the same as calling Apply on the context. The
+// options are:
+//
+//   - WithIO and WithOutputLock: read commands from and write load
+//     reports to other streams than stdin and stdout and share them
+//     with the embedding program
+//   - WithLogOutput: write diagnostic messages to another writer
+//     than stderr
+//   - WithErrorLogInterval: how often repeated sensor errors are
+//     logged
+//   - WithParallelism and WithErrorPolicy: how sensors are executed
+//     and how failures are handled
+//   - WithDefaultInterval: the Interval of sensors without one
+//   - WithResourcePrefix: a prefix for all resource names
+//   - WithReportSink, WithDailyReportLog and WithSinkFormat: copies
+//     of each load report for debugging and auditing
+//   - WithAsyncReportHook: delivers each load report to other systems
+//     without delaying the load sensor protocol
+//   - WithValueFormatter, WithHostTransform and WithTrimSpace: change
+//     values and host names before they are reported
+//   - WithStaleThreshold and WithMaxValueAge: handling of values
+//     which were not measured in the load report
+//   - WithMaxReportSize, WithLineEnding, WithGroupByHost and
+//     WithProtocolWriter: the format of the load reports
+//   - WithCycleDurationResource, WithHeartbeat and
+//     WithErrorComplexes: values the load sensor reports about itself
+//   - WithBackgroundMeasurement, WithEmitOnStartup, WithCatchUp and
+//     WithEOFGracePeriod: when measurements and load reports happen
+//   - WithMaintenanceCheck and WithDrainValues: reporting during
+//     maintenance
+//   - WithFinalReport: the last load report when the load sensor stops
+//   - WithProfile and WithReload: which sensors are measured
+//   - WithRestartCounter: restarts and uptime of the load sensor
+//   - WithLockFile, WithStartupDetection, WithReadinessWindow,
+//     WithMaxCycles and WithClock: process and health settings
+func CreateWithOptions(s []Sensor, opts ...Option) (*Context, error) {
+	ctx, err := Create(s)
+	if err != nil {
+		return nil, err
+	}
+	return ctx.Apply(opts...), nil
+}
+
+// CreateLenient initializes a new load sensor context like Create but
+// instead of failing it drops all invalid sensors. The context with
+// the remaining valid sensors is always returned, the returned error
+// lists all dropped sensors, so that the caller can log them, and is
+// nil when all sensors are valid.
+func CreateLenient(s []Sensor) (*Context, error) {
+	valid := make([]Sensor, 0, len(s))
+	var dropped []error
+	for i := range s {
+		if err := validateSensor(s[i]); err != nil {
+			dropped = append(dropped, fmt.Errorf("dropped sensor %d: %w", i, err))
+			continue
 		}
+		valid = append(valid, s[i])
 	}
-	c := Context{
-		sensors: s,
+	return newContext(valid), errors.Join(dropped...)
+}
+
+// Resources returns the resource names of all sensors of the context
+// in sensor order by calling each ResourceNameFunction once, without
+// measuring anything. This allows to check that all complexes are
+// defined in Grid Engine (see qconf -sc). Sensors whose function fails
+// are left out of the list, the returned error contains all failures.
+// Sensors which are not selected by the active profile are left out as
+// well, like sensors with a ReportsFunction whose resources are only
+// known when they are measured.
+func (ctx *Context) Resources() ([]string, error) {
+	resources := make([]string, 0, len(ctx.sensors))
+	var errs []error
+	for i, sensor := range ctx.sensors {
+		if !ctx.profileSelected(sensor) || sensor.ResourceNameFunction == nil {
+			continue
+		}
+		resource, err := sensor.ResourceNameFunction()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sensor %d: error during resource name function call: %w", i, err))
+			continue
+		}
+		o := ctx.optionsFor(sensor)
+		resources = append(resources, o.resourcePrefix+o.trim(resource))
 	}
-	return &c, nil
+	return resources, errors.Join(errs...)
 }
 
 // Run implements the Univa Grid Engine load sensor protocol and
 // executes in each load report interval the measrements given by
 // the list of structs implementing the Sesorer interface.
-func (ctx Context) Run() {
-	stdin := bufio.NewReader(os.Stdin)
-	//  the UGE load sensor protocol
+//
+// Each load report is written with a single Write call. Run needs
+// exclusive access to its output (stdout unless WithIO is used) since
+// the execd reads everything written to it as part of the protocol.
+// Embedding programs writing to the same stream must share a lock
+// with Run (see WithOutputLock).
+func (ctx *Context) Run() {
+	in, out := ctx.input, ctx.output
+	if in == nil {
+		in = os.Stdin
+	}
+	if out == nil {
+		out = os.Stdout
+	}
+	os.Exit(ctx.run(in, out))
+}
+
+// readCommand reads the next command from the execd. At the end of
+// the input it retries reading during the EOF grace period (see
+// WithEOFGracePeriod).
+func (ctx *Context) readCommand(r *bufio.Reader) (command, error) {
+	cmd, err := readCommand(r)
+	if !errors.Is(err, io.EOF) || ctx.eofGracePeriod <= 0 {
+		return cmd, err
+	}
+	ctx.logf("end of input, waiting up to %s for more input", ctx.eofGracePeriod)
+	deadline := ctx.clock.Now().Add(ctx.eofGracePeriod)
+	for errors.Is(err, io.EOF) && ctx.clock.Now().Before(deadline) {
+		ctx.clock.Sleep(eofRetryInterval)
+		cmd, err = readCommand(r)
+	}
+	return cmd, err
+}
+
+// input is a command or read error passed from the goroutine reading
+// stdin to the protocol loop.
+type input struct {
+	cmd command
+	err error
+}
+
+// readInput reads commands from the execd and passes them to the
+// protocol loop until quit is received, reading fails or done is
+// closed. A quit cancels the running load report immediately. Triggers
+// arriving while a load report is pending or being written are
+// coalesced into one, since the execd only needs the latest values.
+func (ctx *Context) readInput(r *bufio.Reader, inputs chan<- input, quit context.CancelFunc, done <-chan struct{}) {
 	for {
-		line, _, err := stdin.ReadLine()
-		if err != nil {
-			os.Exit(1)
+		cmd, err := ctx.readCommand(r)
+		switch {
+		case err == nil && cmd == commandIgnore:
+			ctx.logf("ignoring invalid input from execd")
+			continue
+		case err == nil && cmd == commandTrigger:
+			select {
+			case inputs <- input{cmd: cmd}:
+			case <-done:
+				return
+			default:
+				// a trigger is already pending
+			}
+			continue
+		case err == nil:
+			quit()
 		}
-		if string(line) == "quit" {
-			os.Exit(0)
+		select {
+		case inputs <- input{cmd: cmd, err: err}:
+		case <-done:
 		}
-		fmt.Println("begin")
-		for _, sensor := range ctx.sensors {
-			host, errHost := sensor.HostNameFunction()
-			if errHost != nil {
-				fmt.Fprintf(os.Stderr, "error during hostname function call: %s\n", errHost)
-				continue
-			}
-			resource, errResource := sensor.ResourceNameFunction()
-			if errResource != nil {
-				fmt.Fprintf(os.Stderr, "error during resource name function call: %s\n", errResource)
-				continue
+		return
+	}
+}
+
+// run executes the load sensor protocol until "quit" is received or
+// reading the input fails and returns the exit status of the process.
+// Commands are read concurrently to the load reports, so a "quit"
+// arriving during a load report aborts it without writing it: the
+// sensors which were not started yet are not executed anymore and the
+// context of running context aware measurements is cancelled (see
+// MeasurementContextFunction). The time between a "quit" and the return
+// of run is therefore at most the time the slowest measurement which is
+// running at that moment needs to finish, or to return after the
+// cancellation.
+func (ctx *Context) run(in io.Reader, out io.Writer) int {
+	if ctx.outputLock != nil {
+		out = lockedWriter{w: out, lock: ctx.outputLock}
+	}
+	if ctx.lockFile != "" {
+		if err := acquireLockFile(ctx.lockFile); err != nil {
+			ctx.logf("%s", err)
+			return 1
+		}
+		defer releaseLockFile(ctx.lockFile)
+	}
+	defer ctx.runShutdown()
+	if ctx.restartFile != "" {
+		ctx.countStart()
+	}
+	if ctx.startupDetection > 0 {
+		if _, err := waitForHostname(ctx.clock, ctx.startupDetection); err != nil {
+			ctx.logf("%s", err)
+			return 1
+		}
+	}
+	stopBackground := func() {}
+	if ctx.background {
+		stopBackground = ctx.startBackground()
+	}
+	defer func() { stopBackground() }()
+	c, quit := context.WithCancel(context.Background())
+	defer quit()
+	inputs := make(chan input, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go ctx.readInput(bufio.NewReader(in), inputs, quit, done)
+	if ctx.reload != nil {
+		go ctx.watchReload(done)
+	}
+	catchUps := make(chan struct{}, 1)
+	if ctx.catchUp > 0 {
+		go ctx.watchGaps(catchUps, done)
+	}
+	// ahead is true while a load report written without a request of
+	// the execd waits in the output for the next request
+	ahead := false
+	//  the UGE load sensor protocol
+	for unsolicited, cycles := ctx.emitOnStartup, 0; ; unsolicited = false {
+		if !unsolicited {
+			select {
+			case next := <-inputs:
+				if next.err != nil {
+					ctx.finalCycle(out)
+					return 1
+				}
+				if next.cmd == commandQuit {
+					ctx.finalCycle(out)
+					return 0
+				}
+				if ahead {
+					ctx.logf("request answered by the load report written ahead")
+					ahead = false
+					continue
+				}
+			case <-catchUps:
+				if ahead {
+					continue
+				}
+				unsolicited = true
 			}
-			measurement, errMeasurement := sensor.MeasurementFunction()
-			if errMeasurement != nil {
-				fmt.Fprintf(os.Stderr, "error during measurement function call: %s\n", errMeasurement)
-				continue
+		}
+		if ctx.reloadPending() {
+			// the background measurements use the old sensors
+			stopBackground()
+			ctx.applyReload()
+			if ctx.background {
+				stopBackground = ctx.startBackground()
 			}
-			// write load value for resource for the given host
-			fmt.Printf("%s:%s:%s\n", host, resource, measurement)
 		}
-		fmt.Println("end")
+		err := ctx.cycle(c, out, false)
+		if c.Err() != nil {
+			ctx.finalCycle(out)
+			return 0
+		}
+		if err != nil {
+			ctx.logf("error writing load report: %s", err)
+			return 1
+		}
+		ahead = unsolicited
+		if cycles++; ctx.maxCycles > 0 && cycles >= ctx.maxCycles {
+			ctx.logf("exiting after %d load reports", cycles)
+			ctx.finalCycle(out)
+			return 0
+		}
 	}
 }
@@ -0,0 +1,245 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// logRecorder collects the diagnostic messages of a context.
+type logRecorder struct {
+	mutex sync.Mutex
+	logs  strings.Builder
+}
+
+func (l *logRecorder) Write(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.logs.Write(p)
+}
+
+// count returns how often message was logged.
+func (l *logRecorder) count(message string) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return strings.Count(l.logs.String(), message)
+}
+
+// wait waits until message was logged n times.
+func (l *logRecorder) wait(t *testing.T, message string, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); l.count(message) < n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%q was not logged %d times", message, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+const answeredAhead = "request answered by the load report written ahead"
+
+// execd plays the execd side of the load sensor protocol of a context
+// running in the background.
+type execd struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	out    *bufio.Reader
+	status chan int
+}
+
+// startExecd runs the context with pipes as its input and output.
+func startExecd(t *testing.T, ctx *Context) *execd {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	e := &execd{t: t, in: inW, out: bufio.NewReader(outR), status: make(chan int, 1)}
+	go func() {
+		e.status <- ctx.run(inR, outW)
+		outW.Close()
+	}()
+	return e
+}
+
+// request triggers a load report and returns it.
+func (e *execd) request() string {
+	e.t.Helper()
+	if _, err := io.WriteString(e.in, "\n"); err != nil {
+		e.t.Fatalf("writing trigger: %s", err)
+	}
+	return e.report()
+}
+
+// report reads the next load report from the output.
+func (e *execd) report() string {
+	e.t.Helper()
+	var report strings.Builder
+	for {
+		line, err := e.out.ReadString('\n')
+		if err != nil {
+			e.t.Fatalf("reading load report %q: %s", report.String(), err)
+		}
+		report.WriteString(line)
+		if line == "end\n" {
+			return report.String()
+		}
+	}
+}
+
+// waitCycles waits until the context recorded n load reports, which
+// happens after they were read.
+func waitCycles(t *testing.T, ctx *Context, n uint64) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); ctx.Status().Cycles < n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("load report %d was not recorded", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// quit stops the context and returns its exit status.
+func (e *execd) quit() int {
+	e.t.Helper()
+	if _, err := io.WriteString(e.in, "quit\n"); err != nil {
+		e.t.Fatalf("writing quit: %s", err)
+	}
+	select {
+	case status := <-e.status:
+		return status
+	case <-time.After(10 * time.Second):
+		e.t.Fatal("load sensor did not quit")
+	}
+	return -1
+}
+
+func TestEmitOnStartupAnswersFirstRequest(t *testing.T) {
+	var calls atomic.Int32
+	logs := &logRecorder{}
+	ctx, err := CreateWithOptions([]Sensor{
+		testSensor("calls", func() (string, error) {
+			return strings.Repeat("x", int(calls.Add(1))), nil
+		}),
+	}, WithEmitOnStartup(), WithLogOutput(logs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := startExecd(t, ctx)
+	for i := 1; i <= 3; i++ {
+		expected := "begin\nhost:calls:" + strings.Repeat("x", i) + "\nend\n"
+		if report := e.request(); report != expected {
+			t.Errorf("request %d: expected %q, got %q", i, expected, report)
+		}
+		if i == 1 {
+			// the next trigger would be coalesced with a pending one
+			logs.wait(t, answeredAhead, 1)
+		}
+	}
+	if status := e.quit(); status != 0 {
+		t.Errorf("unexpected exit status %d", status)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("expected 3 load reports for 3 requests, got %d", n)
+	}
+}
+
+func TestCatchUpAnswersNextRequest(t *testing.T) {
+	var calls atomic.Int32
+	logs := &logRecorder{}
+	clock := NewFakeClock(testStart)
+	ctx, err := CreateWithOptions([]Sensor{
+		testSensor("calls", func() (string, error) {
+			return strings.Repeat("x", int(calls.Add(1))), nil
+		}),
+	}, WithClock(clock), WithCatchUp(40*time.Second), WithLogOutput(logs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := startExecd(t, ctx)
+	if report := e.request(); report != "begin\nhost:calls:x\nend\n" {
+		t.Fatalf("unexpected first report %q", report)
+	}
+	waitCycles(t, ctx, 1)
+	clock.BlockUntil(1)
+	clock.Advance(41 * time.Second)
+	// wait until the catch-up report is written before the next request
+	if _, err := e.out.Peek(1); err != nil {
+		t.Fatal(err)
+	}
+	for i := 2; i <= 3; i++ {
+		expected := "begin\nhost:calls:" + strings.Repeat("x", i) + "\nend\n"
+		if report := e.request(); report != expected {
+			t.Errorf("request %d: expected %q, got %q", i, expected, report)
+		}
+		if i == 2 {
+			logs.wait(t, answeredAhead, 1)
+		}
+	}
+	if status := e.quit(); status != 0 {
+		t.Errorf("unexpected exit status %d", status)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("expected 3 load reports for 3 requests, got %d", n)
+	}
+}
+
+func TestCreateLenient(t *testing.T) {
+	invalid := testSensor("invalid", nil)
+	invalid.MeasurementFunction = nil
+	ctx, err := CreateLenient([]Sensor{
+		testSensor("valid", func() (string, error) { return "1", nil }),
+		invalid,
+	})
+	if err == nil || !strings.Contains(err.Error(), "dropped sensor 1") {
+		t.Errorf("expected the dropped sensor in the error, got %v", err)
+	}
+	if report := runReport(t, ctx); report != "begin\nhost:valid:1\nend\n" {
+		t.Errorf("unexpected report %q", report)
+	}
+}
+
+func TestMaxCyclesWritesFinalReport(t *testing.T) {
+	value := testSensor("value", func() (string, error) { return "1", nil })
+	value.ReportOnChange = true
+	ctx, err := CreateWithOptions([]Sensor{value}, WithMaxCycles(2), WithFinalReport(FinalReportValues),
+		WithLogOutput(&logRecorder{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := startExecd(t, ctx)
+	for i, expected := range []string{"begin\nhost:value:1\nend\n", "begin\nend\n"} {
+		if report := e.request(); report != expected {
+			t.Errorf("request %d: expected %q, got %q", i+1, expected, report)
+		}
+	}
+	if report := e.report(); report != "begin\nhost:value:1\nend\n" {
+		t.Errorf("unexpected final report %q", report)
+	}
+	select {
+	case status := <-e.status:
+		if status != 0 {
+			t.Errorf("unexpected exit status %d", status)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("load sensor did not exit")
+	}
+}
@@ -0,0 +1,85 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// WithLockFile makes Run acquire a lock file at the given path before
+// reporting any load. When another running load sensor holds the
+// lock, Run logs an error and exits instead of producing conflicting
+// load reports for the same host. The lock file contains the pid of
+// the holder. A lock file left behind by a process which is not
+// running anymore is taken over. The lock file is removed when Run
+// terminates.
+func WithLockFile(path string) Option {
+	return func(ctx *Context) {
+		ctx.lockFile = path
+	}
+}
+
+// acquireLockFile creates the lock file containing the pid of the
+// current process. It fails when the file is held by another running
+// process.
+func acquireLockFile(path string) error {
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+			if errClose := f.Close(); err == nil {
+				err = errClose
+			}
+			if err != nil {
+				os.Remove(path)
+				return fmt.Errorf("can not write lock file %s: %w", path, err)
+			}
+			return nil
+		}
+		if !os.IsExist(err) {
+			return fmt.Errorf("can not create lock file %s: %w", path, err)
+		}
+		content, errRead := os.ReadFile(path)
+		if errRead != nil {
+			return fmt.Errorf("can not read lock file %s: %w", path, errRead)
+		}
+		pid, errPid := strconv.Atoi(strings.TrimSpace(string(content)))
+		if errPid == nil && processAlive(pid) {
+			return fmt.Errorf("another load sensor (pid %d) is already running: lock file %s exists", pid, path)
+		}
+		// stale lock file of a terminated load sensor
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("can not remove stale lock file %s: %w", path, err)
+		}
+	}
+	return fmt.Errorf("can not acquire lock file %s", path)
+}
+
+// releaseLockFile removes the lock file when it is still held by the
+// current process.
+func releaseLockFile(path string) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if strings.TrimSpace(string(content)) == strconv.Itoa(os.Getpid()) {
+		os.Remove(path)
+	}
+}
@@ -0,0 +1,57 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAcquireLockFileHeld(t *testing.T) {
+	if !processAlive(os.Getpid()) {
+		t.Fatal("the current process is not alive")
+	}
+	path := filepath.Join(t.TempDir(), "loadsensor.lock")
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getppid())+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := acquireLockFile(path)
+	if err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Fatalf("the lock file of the running parent process was taken over: %v", err)
+	}
+}
+
+func TestAcquireLockFileStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "loadsensor.lock")
+	if err := os.WriteFile(path, []byte("no pid\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := acquireLockFile(path); err != nil {
+		t.Fatalf("the stale lock file was not taken over: %s", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil || strings.TrimSpace(string(content)) != strconv.Itoa(os.Getpid()) {
+		t.Errorf("unexpected lock file content %q, %v", content, err)
+	}
+	releaseLockFile(path)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the lock file was not removed: %v", err)
+	}
+}
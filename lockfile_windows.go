@@ -0,0 +1,45 @@
+//go:build windows
+
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import "syscall"
+
+// processQueryLimitedInformation is the PROCESS_QUERY_LIMITED_INFORMATION
+// access right which is not defined in the syscall package.
+const processQueryLimitedInformation = 0x1000
+
+// stillActive is the exit code of a process which has not terminated.
+const stillActive = 259
+
+// processAlive checks if a process with the given pid exists. Signal 0
+// is not supported on Windows, so the process is opened and its exit
+// code is queried instead. A process which can not be opened for lack
+// of permissions exists.
+func processAlive(pid int) bool {
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return err == syscall.ERROR_ACCESS_DENIED
+	}
+	defer syscall.CloseHandle(handle)
+	var code uint32
+	if err := syscall.GetExitCodeProcess(handle, &code); err != nil {
+		return false
+	}
+	return code == stillActive
+}
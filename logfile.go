@@ -0,0 +1,122 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DailyLogWriter is an io.Writer which appends to one log file per day
+// in a directory. The files are named prefix-YYYY-MM-DD.log after the
+// local date and each line is prefixed with the time it was written in
+// RFC 3339 format. A new file is opened with the first write of a day,
+// old files are neither compressed nor deleted. It is safe for
+// concurrent use.
+type DailyLogWriter struct {
+	mutex  sync.Mutex
+	clock  func() Clock
+	dir    string
+	prefix string
+	day    string
+	file   *os.File
+}
+
+// NewDailyLogWriter creates a DailyLogWriter for the given directory
+// which is created when it does not exist.
+func NewDailyLogWriter(dir, prefix string) *DailyLogWriter {
+	clock := currentClock()
+	return &DailyLogWriter{
+		clock:  func() Clock { return clock },
+		dir:    dir,
+		prefix: prefix,
+	}
+}
+
+// Write writes p to the log file of the current day. Each line of p
+// gets a time stamp.
+func (w *DailyLogWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	now := w.clock().Now()
+	if day := now.Format("2006-01-02"); day != w.day || w.file == nil {
+		if err := w.rotate(day); err != nil {
+			return 0, err
+		}
+	}
+	stamp := []byte(now.Format(time.RFC3339) + " ")
+	var buf bytes.Buffer
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		buf.Write(stamp)
+		buf.Write(line)
+	}
+	if _, err := w.file.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// rotate closes the current log file and opens the one of day.
+func (w *DailyLogWriter) rotate(day string) error {
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+	if err := os.MkdirAll(w.dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(w.dir, w.prefix+"-"+day+".log")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	w.file, w.day = file, day
+	return nil
+}
+
+// Close closes the current log file. A following Write opens it again.
+func (w *DailyLogWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// WithDailyReportLog adds a report sink (see WithReportSink) which
+// keeps a record of every load report in one file per day in dir,
+// named loadsensor-YYYY-MM-DD.log. The time stamps come from the clock
+// of the context at the time of each write, so WithClock may be given
+// before or after this option. The log never becomes part of the Grid
+// Engine protocol stream. The file is closed when Run stops.
+func WithDailyReportLog(dir string) Option {
+	return func(ctx *Context) {
+		w := NewDailyLogWriter(dir, "loadsensor")
+		w.clock = func() Clock { return ctx.clock }
+		WithReportSink(w)(ctx)
+		ctx.OnShutdown(w.Close)
+	}
+}
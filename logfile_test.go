@@ -0,0 +1,44 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDailyReportLogUsesLaterClock(t *testing.T) {
+	dir := t.TempDir()
+	clock := NewFakeClock(time.Date(2001, 2, 3, 12, 0, 0, 0, time.Local))
+	value := func() (string, error) { return "1", nil }
+	ctx, err := CreateWithOptions([]Sensor{testSensor("load", value)},
+		WithDailyReportLog(dir), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runReport(t, ctx)
+	content, err := os.ReadFile(filepath.Join(dir, "loadsensor-2001-02-03.log"))
+	if err != nil {
+		t.Fatalf("the report log does not use the clock of WithClock: %s", err)
+	}
+	if !strings.Contains(string(content), "load:1") {
+		t.Errorf("unexpected report log %q", content)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"io"
+	"os"
+	"sort"
+)
+
+// MaintenanceMode defines what a context reports while the host is
+// in maintenance (see WithMaintenanceCheck).
+type MaintenanceMode int
+
+const (
+	// MaintenanceEmptyReport writes load reports without values, so
+	// that all values of the load sensor disappear from Grid Engine.
+	MaintenanceEmptyReport MaintenanceMode = iota
+	// MaintenanceDrainValues writes load reports containing only the
+	// values set with WithDrainValues, for example a complex which
+	// makes a load threshold of the queues drain the host.
+	MaintenanceDrainValues
+	// MaintenanceNoReport writes nothing at all. The execd expects an
+	// answer to each request, so this delays the load reports of the
+	// execd until its timeout and logs warnings on the execd side.
+	MaintenanceNoReport
+)
+
+// WithMaintenanceCheck sets a function which is called at the start
+// of each load report. While it returns true the host is considered
+// in maintenance: no sensor is measured and the load report is written
+// according to mode. This allows to remove a host from scheduling
+// without stopping the load sensor, for example with FileExists and a
+// flag file created by the administrator.
+func WithMaintenanceCheck(check func() bool, mode MaintenanceMode) Option {
+	return func(ctx *Context) {
+		ctx.maintenanceCheck, ctx.maintenanceMode = check, mode
+	}
+}
+
+// WithDrainValues sets the values reported for the local host during
+// maintenance or a pause (see Pause) with MaintenanceDrainValues and in
+// the final report of FinalReportDrainValues as map from resource to
+// value.
+func WithDrainValues(values map[string]string) Option {
+	return func(ctx *Context) {
+		ctx.drainValues = values
+	}
+}
+
+// FileExists returns a function checking if a file exists at path. It
+// is meant for WithMaintenanceCheck.
+func FileExists(path string) func() bool {
+	return func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+}
+
+// inMaintenance checks if the host is in maintenance.
+func (ctx *Context) inMaintenance() bool {
+	return ctx.maintenanceCheck != nil && ctx.maintenanceCheck()
+}
+
+// maintenanceCycle writes the load report used while the host is in
+// maintenance or the context is paused according to mode. The values
+// of the sensors are missing from it, so the ReportOnChange state of
+// all sensors is reset and their next values are written in any case.
+func (ctx *Context) maintenanceCycle(w io.Writer, mode MaintenanceMode) error {
+	start := ctx.clock.Now()
+	ctx.commitEmitted(nil, nil, nil, false, start)
+	if mode == MaintenanceNoReport {
+		return nil
+	}
+	var report []Report
+	if mode == MaintenanceDrainValues && len(ctx.drainValues) > 0 {
+		host, err := ctx.localHostname()
+		if err != nil {
+			ctx.logf("error during hostname function call: %s", err)
+		} else {
+			resources := make([]string, 0, len(ctx.drainValues))
+			for resource := range ctx.drainValues {
+				resources = append(resources, resource)
+			}
+			sort.Strings(resources)
+			for _, resource := range resources {
+				report = append(report, Report{Host: host, Resource: resource,
+					Value: ctx.drainValues[resource], MeasuredAt: start})
+			}
+		}
+	}
+	_, err := w.Write(ctx.formatReport(report, nil))
+	ctx.record(nil, report, err == nil)
+	ctx.writeSinks(report)
+	return err
+}
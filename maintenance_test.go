@@ -0,0 +1,50 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import "testing"
+
+// onChangeSensor returns a sensor with ReportOnChange which always
+// reports the same value.
+func onChangeSensor() Sensor {
+	s := testSensor("value", func() (string, error) { return "1", nil })
+	s.ReportOnChange = true
+	return s
+}
+
+func TestMaintenanceResetsReportOnChange(t *testing.T) {
+	for _, mode := range []MaintenanceMode{MaintenanceEmptyReport, MaintenanceDrainValues, MaintenanceNoReport} {
+		maintenance := false
+		ctx, err := CreateWithOptions([]Sensor{onChangeSensor()},
+			WithMaintenanceCheck(func() bool { return maintenance }, mode))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report := runReport(t, ctx); report != "begin\nhost:value:1\nend\n" {
+			t.Fatalf("mode %d: unexpected first report %q", mode, report)
+		}
+		if report := runReport(t, ctx); report != "begin\nend\n" {
+			t.Fatalf("mode %d: the unchanged value was reported again: %q", mode, report)
+		}
+		maintenance = true
+		runReport(t, ctx)
+		maintenance = false
+		if report := runReport(t, ctx); report != "begin\nhost:value:1\nend\n" {
+			t.Errorf("mode %d: the value was not reported after the maintenance: %q", mode, report)
+		}
+	}
+}
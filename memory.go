@@ -0,0 +1,195 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseMeminfo parses the content of /proc/meminfo (or the meminfo
+// of a NUMA node) and returns all values converted to bytes.
+func parseMeminfo(content []byte) map[string]uint64 {
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			v *= 1024
+		}
+		// NUMA node meminfo lines are prefixed with "Node <n> "
+		if f := strings.Fields(key); len(f) == 3 && f[0] == "Node" {
+			key = f[2]
+		}
+		values[strings.TrimSpace(key)] = v
+	}
+	return values
+}
+
+// readMeminfo returns the values of /proc/meminfo in bytes.
+func readMeminfo() (map[string]uint64, error) {
+	content, err := readProcFile("/proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	return parseMeminfo(content), nil
+}
+
+// availableMemory returns MemTotal and MemAvailable of /proc/meminfo
+// in bytes.
+func availableMemory() (total, available uint64, err error) {
+	meminfo, err := readMeminfo()
+	if err != nil {
+		return 0, 0, err
+	}
+	available, found := meminfo["MemAvailable"]
+	if !found {
+		return 0, 0, errors.New("no MemAvailable in /proc/meminfo")
+	}
+	return meminfo["MemTotal"], available, nil
+}
+
+// FreeMemoryMeasurement returns a measurement function reporting the
+// memory in bytes which is available for jobs: the available memory of
+// the host (MemAvailable in /proc/meminfo, which includes reclaimable
+// caches) minus reserve bytes kept for the operating system and its
+// daemons. When less than reserve bytes are available 0 is reported.
+// Kernels before 3.14 have no MemAvailable and return an error.
+func FreeMemoryMeasurement(reserve uint64) func() (string, error) {
+	return func() (string, error) {
+		_, available, err := availableMemory()
+		if err != nil {
+			return "", err
+		}
+		if available < reserve {
+			return "0", nil
+		}
+		return strconv.FormatUint(available-reserve, 10), nil
+	}
+}
+
+// FreeMemoryReservePercentMeasurement returns a measurement function
+// like FreeMemoryMeasurement whose reservation is the given percentage
+// (0 to 100) of the total memory of the host (MemTotal) instead of a
+// fixed number of bytes.
+func FreeMemoryReservePercentMeasurement(percent float64) func() (string, error) {
+	return func() (string, error) {
+		if !(percent >= 0 && percent <= 100) {
+			return "", fmt.Errorf("reserved percentage %v is not between 0 and 100", percent)
+		}
+		total, available, err := availableMemory()
+		if err != nil {
+			return "", err
+		}
+		reserve := uint64(float64(total) * percent / 100)
+		if available < reserve {
+			return "0", nil
+		}
+		return strconv.FormatUint(available-reserve, 10), nil
+	}
+}
+
+// NewFreeMemorySensor creates a sensor reporting the memory in bytes
+// available for jobs after reserve bytes were subtracted for the
+// operating system as resource (see FreeMemoryMeasurement). The
+// reserve is a plain number of bytes, like 4<<30 for 4 GiB.
+func NewFreeMemorySensor(resource string, reserve uint64) Sensor {
+	return NewSensor(resource, FreeMemoryMeasurement(reserve))
+}
+
+// SwapUsedMeasurement reports the used swap space in bytes as found
+// in /proc/meminfo (SwapTotal minus SwapFree). When no swap space is
+// configured an error is returned instead of 0 so that "no swap" can
+// be distinguished from "swap is not used".
+func SwapUsedMeasurement() (string, error) {
+	meminfo, err := readMeminfo()
+	if err != nil {
+		return "", err
+	}
+	total, hasTotal := meminfo["SwapTotal"]
+	free, hasFree := meminfo["SwapFree"]
+	if !hasTotal || !hasFree {
+		return "", errors.New("no swap information in /proc/meminfo")
+	}
+	if total == 0 {
+		return "", errors.New("no swap space configured")
+	}
+	if free > total {
+		free = total
+	}
+	return strconv.FormatUint(total-free, 10), nil
+}
+
+// MemoryPressureMeasurement reports the "some avg10" value of the
+// pressure stall information in /proc/pressure/memory: the percentage
+// of time within the last 10 seconds in which at least one task was
+// stalled waiting for memory. Kernels without PSI support (before
+// 4.20 or with PSI disabled) return an error.
+func MemoryPressureMeasurement() (string, error) {
+	content, err := readProcFile("/proc/pressure/memory")
+	if err != nil {
+		return "", fmt.Errorf("no memory pressure information: %w", err)
+	}
+	return parsePressure(content, "some", "avg10")
+}
+
+// parsePressure returns a value of a line of a /proc/pressure file
+// like "some avg10=0.00 avg60=0.00 avg300=0.00 total=0".
+func parsePressure(content []byte, kind, field string) (string, error) {
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != kind {
+			continue
+		}
+		for _, f := range fields[1:] {
+			if value, found := strings.CutPrefix(f, field+"="); found {
+				if _, err := strconv.ParseFloat(value, 64); err != nil {
+					return "", fmt.Errorf("invalid pressure value %q", f)
+				}
+				return value, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no %s %s value in pressure information", kind, field)
+}
+
+// NewSwapSensor creates a sensor reporting the used swap space in
+// bytes as resource.
+func NewSwapSensor(resource string) Sensor {
+	return NewSensor(resource, SwapUsedMeasurement)
+}
+
+// NewMemoryPressureSensor creates a sensor reporting the memory
+// pressure (see MemoryPressureMeasurement) as resource.
+func NewMemoryPressureSensor(resource string) Sensor {
+	return NewSensor(resource, MemoryPressureMeasurement)
+}
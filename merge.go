@@ -0,0 +1,86 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import "io"
+
+// Merge combines the sensors of several contexts into one new context
+// so that a single Run reports all of them in one load report. The
+// sensors are reported in the order of the given contexts. Each sensor
+// keeps the options of its context which change its values: the
+// resource prefix (WithResourcePrefix), the host transformation
+// (WithHostTransform), the value formatter (WithValueFormatter) and the
+// trimming of whitespace (WithTrimSpace), as well as the Interval set
+// by WithDefaultInterval. Applying the first four options to the
+// merged context only affects sensors loaded later by WithReload. The
+// report sinks and async report hooks of all contexts receive the
+// merged load reports and the parallelism is the highest of all
+// contexts. All other settings, like the input and output, are taken
+// from the first context. A warning is logged for each resource name
+// (including its prefix) which is reported by more than one sensor.
+func Merge(ctxs ...*Context) *Context {
+	var sensors []Sensor
+	for _, c := range ctxs {
+		if c == nil {
+			continue
+		}
+		for _, sensor := range c.sensors {
+			if sensor.options == nil {
+				sensor.options = c.optionsFor(sensor)
+			}
+			sensors = append(sensors, sensor)
+		}
+	}
+	merged := newContext(sensors)
+	first := true
+	for _, c := range ctxs {
+		if c == nil {
+			continue
+		}
+		if first {
+			merged.config = c.config
+			merged.config.resourcePrefix, merged.config.hostTransform = "", nil
+			merged.config.valueFormatter, merged.config.keepSpace = nil, false
+			merged.config.defaultInterval = 0
+			merged.config.sinks = append([]io.Writer(nil), c.sinks...)
+			merged.config.hooks = append([]*asyncHook(nil), c.hooks...)
+			first = false
+			continue
+		}
+		merged.sinks = append(merged.sinks, c.sinks...)
+		merged.hooks = append(merged.hooks, c.hooks...)
+		if c.parallelism > merged.parallelism {
+			merged.parallelism = c.parallelism
+		}
+	}
+	seen := make(map[string]bool)
+	for _, sensor := range merged.sensors {
+		if sensor.ResourceNameFunction == nil {
+			continue
+		}
+		resource, err := sensor.ResourceNameFunction()
+		if err != nil {
+			continue
+		}
+		resource = sensor.options.resourcePrefix + sensor.options.trim(resource)
+		if seen[resource] {
+			merged.logf("warning: resource %s is reported by more than one sensor", resource)
+		}
+		seen[resource] = true
+	}
+	return merged
+}
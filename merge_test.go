@@ -0,0 +1,71 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergeKeepsSensorOptions(t *testing.T) {
+	a, err := CreateWithOptions([]Sensor{testSensor("load", func() (string, error) { return " 1 ", nil })},
+		WithResourcePrefix("a_"), WithHostTransform(strings.ToUpper))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sink strings.Builder
+	b, err := CreateWithOptions([]Sensor{testSensor("load", func() (string, error) { return " 2 ", nil })},
+		WithResourcePrefix("b_"), WithTrimSpace(false), WithReportSink(&sink),
+		WithValueFormatter(func(v string) string { return "[" + v + "]" }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := &logRecorder{}
+	a.Apply(WithLogOutput(logs))
+	merged := Merge(a, nil, b)
+	expected := "begin\nHOST:a_load:1\nhost:b_load:[ 2 ]\nend\n"
+	if report := runReport(t, merged); report != expected {
+		t.Errorf("expected %q, got %q", expected, report)
+	}
+	if !strings.Contains(sink.String(), "b_load") {
+		t.Errorf("the report sink of the second context got %q", sink.String())
+	}
+	if resources, err := merged.Resources(); err != nil || strings.Join(resources, " ") != "a_load b_load" {
+		t.Errorf("unexpected resources %q, %v", resources, err)
+	}
+	if logs.count("more than one sensor") != 0 {
+		t.Errorf("resources with different prefixes were reported as duplicates: %q", logs.logs.String())
+	}
+}
+
+func TestMergeDuplicateResources(t *testing.T) {
+	value := func() (string, error) { return "1", nil }
+	a, err := CreateWithOptions([]Sensor{testSensor("load", value)}, WithResourcePrefix("x_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Create([]Sensor{testSensor("x_load", value)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := &logRecorder{}
+	a.Apply(WithLogOutput(logs))
+	Merge(a, b)
+	if n := logs.count("warning: resource x_load is reported by more than one sensor"); n != 1 {
+		t.Errorf("expected one duplicate warning, got %q", logs.logs.String())
+	}
+}
@@ -0,0 +1,127 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// NewMultiHostSensor creates a sensor which reports values for several
+// hosts, for example a gateway collecting the power draw of many nodes
+// from their BMCs. The function returns the values of its current
+// measurement as Reports of which only Host, Resource and Value are
+// used (see Sensor.ReportsFunction).
+func NewMultiHostSensor(f func(context.Context) ([]Report, error)) Sensor {
+	return Sensor{ReportsFunction: f}
+}
+
+// NewMultiValueSensor creates a sensor which reports several values of
+// the local host (see LocalHostname) computed together, for example a
+// free memory and a memory usage in percent derived from the same read
+// of /proc/meminfo. The function returns a map from resource to value,
+// each entry is written as line of its own, sorted by resource. Each
+// resource name and value is checked like the ones of other sensors,
+// invalid entries are dropped and logged as failure of the sensor
+// while the remaining values are still reported. Of entries whose
+// resources are equal after trimming and prefixing only the first in
+// sort order is reported, a different value of another one is logged
+// as failure as well. An empty value omits the resource. The sensor is
+// a ReportsFunction, so the restrictions of multi-host sensors apply
+// (see Sensor.ReportsFunction).
+func NewMultiValueSensor(f func() (map[string]string, error)) Sensor {
+	return Sensor{ReportsFunction: func(context.Context) ([]Report, error) {
+		values, err := f()
+		if err != nil {
+			return nil, err
+		}
+		host, err := LocalHostname()
+		if err != nil {
+			return nil, fmt.Errorf("error during hostname function call: %w", err)
+		}
+		resources := make([]string, 0, len(values))
+		for resource := range values {
+			resources = append(resources, resource)
+		}
+		sort.Strings(resources)
+		reports := make([]Report, 0, len(resources))
+		for _, resource := range resources {
+			reports = append(reports, Report{Host: host, Resource: resource, Value: values[resource]})
+		}
+		return reports, nil
+	}}
+}
+
+// measureReports executes the ReportsFunction of a sensor. The host,
+// resource and value of each returned report are transformed like the
+// ones of other sensors and checked against the load sensor protocol.
+// Invalid and duplicate values are dropped, the errors of invalid and
+// conflicting values are returned together with the valid values (see
+// measurement.failed).
+func (ctx *Context) measureReports(c context.Context, sensor Sensor) measurement {
+	info := &callInfo{}
+	reports, errMeasurement := sensor.ReportsFunction(context.WithValue(c, callKey{}, info))
+	if info.measuredAt.IsZero() {
+		info.measuredAt = ctx.clock.Now()
+	}
+	if errors.Is(errMeasurement, ErrClear) {
+		return measurement{ran: true, skipped: true, cleared: true}
+	}
+	if errors.Is(errMeasurement, ErrSkip) {
+		return measurement{ran: true, skipped: true}
+	}
+	if errMeasurement != nil {
+		return measurement{ran: true, err: fmt.Errorf("error during reports function call: %w", errMeasurement)}
+	}
+	var valid []Report
+	var errs []error
+	seen := make(map[string]string, len(reports))
+	o := ctx.optionsFor(sensor)
+	for _, r := range reports {
+		host, resource := o.trim(r.Host), o.resourcePrefix+o.trim(r.Resource)
+		if o.hostTransform != nil && host != "" {
+			host = o.hostTransform(host)
+		}
+		value, err := ctx.checkValue(sensor, r.Value)
+		if err == nil && value == "" {
+			continue
+		}
+		if err == nil {
+			err = validateLine(host + ":" + resource + ":" + value)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		key := host + ":" + resource
+		if previous, found := seen[key]; found {
+			if previous != value {
+				errs = append(errs, fmt.Errorf("conflicting values %q and %q for %s", previous, value, key))
+			}
+			continue
+		}
+		seen[key] = value
+		valid = append(valid, Report{Host: host, Resource: resource, Value: value, MeasuredAt: info.measuredAt})
+	}
+	m := measurement{ran: true, reports: valid, measuredAt: info.measuredAt, skipped: len(valid) == 0}
+	if len(errs) > 0 {
+		m.err = fmt.Errorf("error during reports function call: %w", errors.Join(errs...))
+	}
+	return m
+}
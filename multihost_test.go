@@ -0,0 +1,67 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPartialReportsWithFailFast(t *testing.T) {
+	multi := NewMultiHostSensor(func(context.Context) ([]Report, error) {
+		return []Report{
+			{Host: "a", Resource: "power", Value: "100"},
+			{Host: "b", Resource: "power", Value: "1.2e+06"},
+			{Host: "a", Resource: "power", Value: "100"},
+			{Host: "a", Resource: "power", Value: "200"},
+		}, nil
+	})
+	logs := &logRecorder{}
+	ctx, err := CreateWithOptions([]Sensor{multi, testSensor("value", func() (string, error) { return "1", nil })},
+		WithErrorPolicy(FailFast), WithLogOutput(logs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report := runReport(t, ctx); report != "begin\na:power:100\nhost:value:1\nend\n" {
+		t.Errorf("unexpected report %q", report)
+	}
+	for _, message := range []string{"exponential notation", `conflicting values "100" and "200" for a:power`} {
+		if logs.count(message) != 1 {
+			t.Errorf("%q was not logged: %q", message, logs.logs.String())
+		}
+	}
+}
+
+func TestMultiValueSensorDuplicates(t *testing.T) {
+	multi := NewMultiValueSensor(func() (map[string]string, error) {
+		return map[string]string{"free": "1", " free": "1", "free ": "2", "used": "3"}, nil
+	})
+	logs := &logRecorder{}
+	ctx, err := CreateWithOptions([]Sensor{multi}, WithLogOutput(logs), WithHostTransform(func(string) string { return "host" }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetDefaultRunner(RunnerFunc(fakeGridEngine("lx-amd64", "node1")))
+	t.Setenv("SGE_ROOT", "/opt/uge")
+	t.Cleanup(func() { SetDefaultRunner(nil) })
+	if report := runReport(t, ctx); report != "begin\nhost:free:1\nhost:used:3\nend\n" {
+		t.Errorf("unexpected report %q", report)
+	}
+	if logs.count(`conflicting values "1" and "2" for host:free`) != 1 {
+		t.Errorf("the conflicting value was not logged: %q", logs.logs.String())
+	}
+}
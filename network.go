@@ -0,0 +1,98 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// tcpEstablished is the state of an established connection in
+// /proc/net/tcp (see include/net/tcp_states.h).
+const tcpEstablished = "01"
+
+// countTCPConnections counts the established connections listed in
+// the content of /proc/net/tcp or /proc/net/tcp6. Each line after the
+// header has the format "sl local_address rem_address st ..." where
+// the addresses are hex encoded as ADDRESS:PORT and st is the hex
+// encoded connection state. When port is not 0 only connections with
+// that local port are counted.
+func countTCPConnections(content []byte, port int) (int, error) {
+	count := 0
+	for i, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if i == 0 || len(fields) < 4 {
+			continue
+		}
+		if fields[3] != tcpEstablished {
+			continue
+		}
+		if port != 0 {
+			sep := strings.LastIndexByte(fields[1], ':')
+			if sep < 0 {
+				return 0, fmt.Errorf("invalid local address %q", fields[1])
+			}
+			local, err := strconv.ParseUint(fields[1][sep+1:], 16, 16)
+			if err != nil {
+				return 0, fmt.Errorf("invalid local address %q: %w", fields[1], err)
+			}
+			if int(local) != port {
+				continue
+			}
+		}
+		count++
+	}
+	return count, nil
+}
+
+// TCPConnectionsMeasurement returns a measurement function reporting
+// the number of established TCP connections of the host, both over
+// IPv4 (/proc/net/tcp) and IPv6 (/proc/net/tcp6). When port is not 0
+// only connections with that local port are counted, for example the
+// clients connected to a service listening on the port. A missing
+// /proc/net/tcp6 (IPv6 disabled) is not an error. It is only supported
+// on Linux.
+func TCPConnectionsMeasurement(port int) func() (string, error) {
+	return func() (string, error) {
+		total := 0
+		for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+			content, err := readProcFile(path)
+			if err != nil {
+				if path == "/proc/net/tcp6" && errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+				return "", err
+			}
+			count, err := countTCPConnections(content, port)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", path, err)
+			}
+			total += count
+		}
+		return strconv.Itoa(total), nil
+	}
+}
+
+// NewTCPConnectionsSensor creates a sensor reporting the number of
+// established TCP connections (see TCPConnectionsMeasurement) as
+// resource.
+func NewTCPConnectionsSensor(resource string, port int) Sensor {
+	return NewSensor(resource, TCPConnectionsMeasurement(port))
+}
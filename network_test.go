@@ -0,0 +1,76 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import "testing"
+
+const procNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 20171 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0CEA 0100007F:A2B4 01 00000000:00000000 00:00000000 00000000   999        0 31337 1 0000000000000000 20 4 30 10 -1
+   2: 0A00020F:0016 0A000201:D6F2 01 00000000:00000000 02:000A7D7E 00000000     0        0 24162 4 0000000000000000 20 4 31 10 -1
+   3: 0A00020F:0016 0A000202:C350 06 00000000:00000000 03:00000C2B 00000000     0        0 0 3 0000000000000000
+`
+
+const procNetTCP6 = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:0016 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 20173 1 0000000000000000 100 0 0 10 0
+   1: 0000000000000000FFFF00000F02000A:0016 0000000000000000FFFF00000102000A:E0B8 01 00000000:00000000 02:00069BCF 00000000     0        0 41234 2 0000000000000000 20 4 29 10 -1
+`
+
+func TestCountTCPConnections(t *testing.T) {
+	tests := []struct {
+		content  string
+		port     int
+		expected int
+	}{
+		{procNetTCP, 0, 2},
+		{procNetTCP, 22, 1},
+		{procNetTCP, 3306, 1},
+		{procNetTCP, 80, 0},
+		{procNetTCP6, 0, 1},
+		{procNetTCP6, 22, 1},
+		{"", 0, 0},
+		// only the header, which is skipped even when it has 4 fields
+		{"  sl  local_address rem_address st\n", 0, 0},
+		// short lines are ignored
+		{"header\n   0: 0100007F:0016\n\n", 22, 0},
+	}
+	for i, test := range tests {
+		count, err := countTCPConnections([]byte(test.content), test.port)
+		if err != nil {
+			t.Errorf("test %d: %s", i, err)
+			continue
+		}
+		if count != test.expected {
+			t.Errorf("test %d: expected %d connections, got %d", i, test.expected, count)
+		}
+	}
+}
+
+func TestCountTCPConnectionsMalformed(t *testing.T) {
+	for _, line := range []string{
+		"   0: 0100007F 0100007F:A2B4 01",
+		"   0: 0100007F:XYZ 0100007F:A2B4 01",
+		"   0: 0100007F:10000 0100007F:A2B4 01",
+	} {
+		if _, err := countTCPConnections([]byte("header\n"+line+"\n"), 22); err == nil {
+			t.Errorf("no error for %q", line)
+		}
+		if count, err := countTCPConnections([]byte("header\n"+line+"\n"), 0); err != nil || count != 1 {
+			t.Errorf("without port filter %q: got %d, %v", line, count, err)
+		}
+	}
+}
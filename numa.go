@@ -0,0 +1,104 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// numaNodeDir is the directory containing one nodeN directory per
+// NUMA node.
+const numaNodeDir = "/sys/devices/system/node"
+
+// numaNodes returns the numbers of all NUMA nodes in ascending order.
+// Node numbers are not necessarily contiguous. A kernel without NUMA
+// support has no node directory, the host is reported as single node
+// 0 then.
+func numaNodes() ([]int, error) {
+	if err := requireLinux(); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(numaNodeDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []int{0}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var nodes []int
+	for _, entry := range entries {
+		if number, found := strings.CutPrefix(entry.Name(), "node"); found {
+			if n, err := strconv.Atoi(number); err == nil {
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	if len(nodes) == 0 {
+		return []int{0}, nil
+	}
+	sort.Ints(nodes)
+	return nodes, nil
+}
+
+// NUMANodeMemoryFreeMeasurement returns a measurement function
+// reporting the free memory of the given NUMA node in bytes (MemFree
+// of /sys/devices/system/node/node<node>/meminfo). On kernels without
+// NUMA support node 0 reports the free memory of the host from
+// /proc/meminfo. It is only supported on Linux.
+func NUMANodeMemoryFreeMeasurement(node int) func() (string, error) {
+	return func() (string, error) {
+		path := filepath.Join(numaNodeDir, fmt.Sprintf("node%d", node), "meminfo")
+		content, err := readProcFile(path)
+		if errors.Is(err, fs.ErrNotExist) && node == 0 {
+			if _, errDir := os.Stat(numaNodeDir); errors.Is(errDir, fs.ErrNotExist) {
+				content, err = readProcFile("/proc/meminfo")
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+		free, found := parseMeminfo(content)["MemFree"]
+		if !found {
+			return "", fmt.Errorf("no MemFree in meminfo of NUMA node %d", node)
+		}
+		return strconv.FormatUint(free, 10), nil
+	}
+}
+
+// NewNUMANodeMemoryFreeSensors creates one sensor per NUMA node
+// reporting its free memory in bytes as resource numa<node>_mem
+// (numa0_mem, numa1_mem, ...). The NUMA nodes are determined once when
+// the sensors are created. A host without NUMA gets a single numa0_mem
+// sensor.
+func NewNUMANodeMemoryFreeSensors() ([]Sensor, error) {
+	nodes, err := numaNodes()
+	if err != nil {
+		return nil, err
+	}
+	sensors := make([]Sensor, 0, len(nodes))
+	for _, node := range nodes {
+		sensors = append(sensors, NewSensor(fmt.Sprintf("numa%d_mem", node), NUMANodeMemoryFreeMeasurement(node)))
+	}
+	return sensors, nil
+}
@@ -0,0 +1,265 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Option changes the configuration of a load sensor context.
+type Option func(*Context)
+
+// Apply changes the configuration of the context by applying all
+// given options in order. It must be called before Run.
+func (ctx *Context) Apply(opts ...Option) *Context {
+	for _, opt := range opts {
+		opt(ctx)
+	}
+	return ctx
+}
+
+// WithClock sets the clock the context uses for all time
+// measurements. The default is the clock set by SetDefaultClock.
+func WithClock(c Clock) Option {
+	return func(ctx *Context) {
+		if c == nil {
+			c = currentClock()
+		}
+		ctx.clock = c
+	}
+}
+
+// WithValueFormatter sets a function which is applied to every
+// measured value before it is reported, for example to enforce a
+// site wide precision or to normalize decimal separators. It runs
+// after any formatting done by the measurement functions themselves
+// and before the value is validated. A formatter returning an empty
+// string omits the value like ErrSkip. Values of sensors with a
+// Precision are not passed to the formatter. By default values are
+// reported unchanged.
+func WithValueFormatter(f func(raw string) string) Option {
+	return func(ctx *Context) {
+		ctx.valueFormatter = f
+	}
+}
+
+// WithHostTransform sets a function which is applied to the host name
+// returned by the HostNameFunction of every sensor, for example to
+// strip the domain or to lower case it when Grid Engine knows the host
+// by a different name than it resolves to. Grid Engine silently
+// ignores values reported for unknown host names. A transformation
+// resulting in an empty host name is reported as error of the sensor.
+func WithHostTransform(f func(host string) string) Option {
+	return func(ctx *Context) {
+		ctx.hostTransform = f
+	}
+}
+
+// MaxEOFGracePeriod is the upper bound of the grace period set by
+// WithEOFGracePeriod.
+const MaxEOFGracePeriod = 10 * time.Minute
+
+// eofRetryInterval is the time between two reads of stdin during the
+// EOF grace period.
+const eofRetryInterval = time.Second
+
+// WithEOFGracePeriod lets Run tolerate the end of stdin for the given
+// period, for example when a wrapper between the execd and the load
+// sensor reconnects. After an EOF stdin is read again every second
+// until new input arrives or the period elapsed. Note that a consumer
+// which is really gone keeps the load sensor alive for the whole
+// period. The period is limited to MaxEOFGracePeriod. The default of 0
+// terminates immediately at the end of stdin.
+func WithEOFGracePeriod(d time.Duration) Option {
+	return func(ctx *Context) {
+		if d > MaxEOFGracePeriod {
+			d = MaxEOFGracePeriod
+		}
+		ctx.eofGracePeriod = d
+	}
+}
+
+// WithEmitOnStartup writes a load report as soon as Run starts,
+// before the execd requests the first one, so that the first request
+// is answered without waiting for the measurements. The report is
+// framed by begin and end like every other load report. The execd
+// reads one load report per request, so the startup report waits in
+// the output until the first request arrives and answers it: no
+// further load report is written for that request, otherwise the
+// execd would read every following load report one request late. The
+// following load reports are written on request as usual. With
+// WithBackgroundMeasurement the startup report only contains the
+// sensors which were measured by then, usually none.
+func WithEmitOnStartup() Option {
+	return func(ctx *Context) {
+		ctx.emitOnStartup = true
+	}
+}
+
+// WithMaxCycles makes Run exit with status 0 after it wrote n load
+// reports, for example to contain slow memory leaks of third party
+// measurement code or to refresh the process periodically. The report
+// of WithEmitOnStartup and catch-up reports (see WithCatchUp) count
+// towards n. The last load report is written completely, then the
+// final report of WithFinalReport is written and the functions
+// registered with OnShutdown are called before Run returns. This relies on the execd,
+// which restarts a load sensor which exited with its next load report
+// interval, or on a supervisor to start the load sensor again; until
+// then no values are reported. Zero, the default, runs until "quit" is
+// received.
+func WithMaxCycles(n int) Option {
+	return func(ctx *Context) {
+		ctx.maxCycles = n
+	}
+}
+
+// WithIO sets the streams Run uses for the load sensor protocol
+// instead of stdin and stdout, for example to run the load sensor
+// behind a wrapper process. A nil stream keeps the default.
+func WithIO(in io.Reader, out io.Writer) Option {
+	return func(ctx *Context) {
+		ctx.input, ctx.output = in, out
+	}
+}
+
+// WithOutputLock sets a lock which Run holds while it writes a load
+// report to its output, for embedding programs which write to the same
+// stream, like stdout, themselves. Each load report is written from
+// begin to end with a single Write call, so as long as the embedding
+// program holds the lock for its own writes, its output never ends up
+// inside a load report. Without the lock Run needs exclusive access to
+// its output: the execd reads everything the load sensor writes to
+// stdout as part of the protocol.
+func WithOutputLock(l sync.Locker) Option {
+	return func(ctx *Context) {
+		ctx.outputLock = l
+	}
+}
+
+// lockedWriter holds a lock during each Write.
+type lockedWriter struct {
+	w    io.Writer
+	lock sync.Locker
+}
+
+func (w lockedWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.w.Write(p)
+}
+
+// WithLogOutput sets the writer receiving the diagnostic messages of
+// the context, like errors of sensors, instead of stderr. It must not
+// be the output of the load sensor protocol. Nil restores stderr.
+func WithLogOutput(w io.Writer) Option {
+	return func(ctx *Context) {
+		ctx.logOutput = w
+	}
+}
+
+// WithDefaultInterval sets the Interval of all sensors of the context
+// which have no Interval set (see Sensor.Interval), including sensors
+// loaded later by WithReload. The sensors given to Create are not
+// modified.
+func WithDefaultInterval(d time.Duration) Option {
+	return func(ctx *Context) {
+		ctx.defaultInterval = d
+		ctx.sensors = withDefaultInterval(ctx.sensors, d)
+	}
+}
+
+// withDefaultInterval returns a copy of the sensors in which all
+// sensors without Interval have the Interval d.
+func withDefaultInterval(s []Sensor, d time.Duration) []Sensor {
+	sensors := append([]Sensor(nil), s...)
+	for i := range sensors {
+		if sensors[i].Interval == 0 {
+			sensors[i].Interval = d
+		}
+	}
+	return sensors
+}
+
+// WithResourcePrefix prepends prefix to the resource name of every
+// sensor, for example to separate the complexes of several load
+// sensors like "site_" in site_scratch_free. The resources of the
+// built-in values (like WithHeartbeat) are used as given.
+func WithResourcePrefix(prefix string) Option {
+	return func(ctx *Context) {
+		ctx.resourcePrefix = prefix
+	}
+}
+
+// WithStartupDetection lets Run wait up to timeout for the detection of
+// the Grid Engine architecture and the local host name (see
+// WaitForHostname) before the first load report, instead of failing
+// all sensors depending on it when SGE_ROOT is not available yet. When
+// the detection still fails Run logs the *StartupError and exits with
+// status 1. By default no detection is done at startup.
+func WithStartupDetection(timeout time.Duration) Option {
+	return func(ctx *Context) {
+		ctx.startupDetection = timeout
+	}
+}
+
+// WithTrimSpace sets whether leading and trailing whitespace like the
+// newline of a command output is removed from the host, the resource
+// and the value returned by the functions of a sensor before they are
+// reported, so that a measurement returning "  42\n" reports "42".
+// Trimming is enabled by default, like for the output of the Grid
+// Engine binaries read by Arch and LocalHostname. Without trimming a
+// value with whitespace is reported unchanged.
+func WithTrimSpace(trim bool) Option {
+	return func(ctx *Context) {
+		ctx.keepSpace = !trim
+	}
+}
+
+// sensorOptions are the options of a context which change the host
+// names, resource names and values of its sensors. Sensors of merged
+// contexts keep the options of the context they come from (see Merge).
+type sensorOptions struct {
+	resourcePrefix string
+	keepSpace      bool
+	hostTransform  func(string) string
+	valueFormatter func(string) string
+}
+
+// optionsFor returns the options which apply to the given sensor.
+func (ctx *Context) optionsFor(sensor Sensor) *sensorOptions {
+	if sensor.options != nil {
+		return sensor.options
+	}
+	return &sensorOptions{
+		resourcePrefix: ctx.resourcePrefix,
+		keepSpace:      ctx.keepSpace,
+		hostTransform:  ctx.hostTransform,
+		valueFormatter: ctx.valueFormatter,
+	}
+}
+
+// trim removes leading and trailing whitespace unless disabled with
+// WithTrimSpace.
+func (o *sensorOptions) trim(s string) string {
+	if o.keepSpace {
+		return s
+	}
+	return strings.TrimSpace(s)
+}
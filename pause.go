@@ -0,0 +1,56 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+// Pause stops the reporting of the context until Resume is called, for
+// example while the embedding program performs an operation during
+// which no values should reach Grid Engine. While paused, triggers of
+// the execd are still answered and "quit" is handled, but no sensor is
+// measured and the load reports are written according to mode like in
+// maintenance (see MaintenanceMode). Pause can be called concurrently
+// to Run. Pausing a paused context only changes the mode.
+func (ctx *Context) Pause(mode MaintenanceMode) {
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	ctx.paused, ctx.pauseMode = true, mode
+}
+
+// Resume continues the reporting of a context stopped with Pause with
+// the next load report, which contains the values of sensors with
+// ReportOnChange even when they did not change during the pause. It
+// can be called concurrently to Run and does nothing when the context
+// is not paused.
+func (ctx *Context) Resume() {
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	ctx.paused = false
+}
+
+// Paused returns true while the context is paused (see Pause).
+func (ctx *Context) Paused() bool {
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	return ctx.paused
+}
+
+// pausedMode returns the mode of the load reports while the context
+// is paused and false when it is not paused.
+func (ctx *Context) pausedMode() (MaintenanceMode, bool) {
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	return ctx.pauseMode, ctx.paused
+}
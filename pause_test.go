@@ -0,0 +1,40 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import "testing"
+
+func TestResumeReportsUnchangedValues(t *testing.T) {
+	for _, mode := range []MaintenanceMode{MaintenanceEmptyReport, MaintenanceDrainValues, MaintenanceNoReport} {
+		ctx, err := Create([]Sensor{onChangeSensor()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report := runReport(t, ctx); report != "begin\nhost:value:1\nend\n" {
+			t.Fatalf("mode %d: unexpected first report %q", mode, report)
+		}
+		ctx.Pause(mode)
+		runReport(t, ctx)
+		ctx.Resume()
+		if report := runReport(t, ctx); report != "begin\nhost:value:1\nend\n" {
+			t.Errorf("mode %d: the value was not reported after Resume: %q", mode, report)
+		}
+		if report := runReport(t, ctx); report != "begin\nend\n" {
+			t.Errorf("mode %d: the unchanged value was reported again: %q", mode, report)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+//go:build linux && loadsensor_plugins
+
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// PluginSymbol is the name of the function LoadPlugin looks up in a
+// sensor plugin.
+const PluginSymbol = "Sensors"
+
+// LoadPlugin opens the Go plugin (see package plugin) at path and
+// returns the sensors created by its exported PluginSymbol function,
+// which must have the signature
+//
+//	func Sensors() ([]loadsensor.Sensor, error)
+//
+// This allows to add sensors to a load sensor without rebuilding it.
+// Go plugins have strict ABI requirements: the plugin must be built
+// with the same Go version, the same build flags and the same version
+// of this package (and all other shared packages) as the program
+// loading it, otherwise opening it fails. A plugin can not be unloaded.
+// Plugin support requires Linux, cgo and the build tag
+// loadsensor_plugins, without it LoadPlugin returns an error wrapping
+// ErrUnsupportedPlatform.
+func LoadPlugin(path string) ([]Sensor, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("can not open sensor plugin %s: %w", path, err)
+	}
+	symbol, err := p.Lookup(PluginSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("sensor plugin %s: %w", path, err)
+	}
+	sensors, ok := symbol.(func() ([]Sensor, error))
+	if !ok {
+		return nil, fmt.Errorf("sensor plugin %s: %s has type %T instead of func() ([]loadsensor.Sensor, error)",
+			path, PluginSymbol, symbol)
+	}
+	s, err := sensors()
+	if err != nil {
+		return nil, fmt.Errorf("sensor plugin %s: %w", path, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,33 @@
+//go:build !linux || !loadsensor_plugins
+
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import "fmt"
+
+// PluginSymbol is the name of the function LoadPlugin looks up in a
+// sensor plugin.
+const PluginSymbol = "Sensors"
+
+// LoadPlugin loads sensors from a Go plugin. It is only available on
+// Linux with the build tag loadsensor_plugins, otherwise an error
+// wrapping ErrUnsupportedPlatform is returned.
+func LoadPlugin(path string) ([]Sensor, error) {
+	return nil, fmt.Errorf("%w: sensor plugin %s requires the build tag loadsensor_plugins on linux",
+		ErrUnsupportedPlatform, path)
+}
@@ -0,0 +1,133 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// raplZones is the glob matching the RAPL power zones of all CPU
+// packages. Sub zones (like intel-rapl:0:0 for the cores) are part of
+// their package zone and are filtered out.
+const raplZones = "/sys/class/powercap/intel-rapl:*"
+
+// raplCounter is the energy counter of a RAPL zone in microjoules.
+type raplCounter struct {
+	energy    uint64
+	maxEnergy uint64
+}
+
+// readRAPL reads the energy counters of all package zones.
+func readRAPL() (map[string]raplCounter, error) {
+	if err := requireLinux(); err != nil {
+		return nil, err
+	}
+	zones, err := filepath.Glob(raplZones)
+	if err != nil {
+		return nil, err
+	}
+	counters := make(map[string]raplCounter)
+	for _, zone := range zones {
+		if strings.Count(filepath.Base(zone), ":") != 1 {
+			continue
+		}
+		energy, err := readUintFile(filepath.Join(zone, "energy_uj"))
+		if err != nil {
+			if os.IsPermission(err) {
+				return nil, fmt.Errorf("no permission to read RAPL energy counter of %s (root required): %w", zone, err)
+			}
+			return nil, fmt.Errorf("can not read RAPL energy counter of %s: %w", zone, err)
+		}
+		maxEnergy, err := readUintFile(filepath.Join(zone, "max_energy_range_uj"))
+		if err != nil {
+			return nil, fmt.Errorf("can not read RAPL energy range of %s: %w", zone, err)
+		}
+		counters[zone] = raplCounter{energy: energy, maxEnergy: maxEnergy}
+	}
+	if len(counters) == 0 {
+		return nil, errors.New("no RAPL power zones found in /sys/class/powercap (not exposed on this CPU or virtual machine)")
+	}
+	return counters, nil
+}
+
+// readUintFile reads a file containing a single unsigned integer.
+func readUintFile(path string) (uint64, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+}
+
+// watts returns the average power draw between two samples. Counters
+// which wrapped around since the previous sample are corrected by
+// their energy range.
+func watts(previous, current map[string]raplCounter, elapsed time.Duration) (float64, error) {
+	if elapsed <= 0 {
+		return 0, errors.New("no time elapsed between RAPL samples")
+	}
+	var microjoules float64
+	for zone, c := range current {
+		p, ok := previous[zone]
+		if !ok {
+			return 0, fmt.Errorf("RAPL zone %s appeared between samples", zone)
+		}
+		if c.energy >= p.energy {
+			microjoules += float64(c.energy - p.energy)
+		} else {
+			microjoules += float64(c.maxEnergy - p.energy + c.energy)
+		}
+	}
+	return microjoules / 1e6 / elapsed.Seconds(), nil
+}
+
+// powerDraw formats the average power draw between two samples in
+// watts.
+func powerDraw(previous, current map[string]raplCounter, elapsed time.Duration) (string, error) {
+	w, err := watts(previous, current, elapsed)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(w, 'f', 1, 64), nil
+}
+
+// PowerDrawMeasurement returns a measurement function reporting the
+// power draw of all CPU packages in watts, read from the RAPL energy
+// counters of /sys/class/powercap. Power is derived from two samples
+// of the counters: the first call samples twice within a short period,
+// each following call reports the average power since the previous
+// call, which is the average over the load report interval. The
+// counters cover the CPU packages (and, depending on the CPU, the
+// memory) but not the whole node. An error is returned when RAPL is
+// not exposed (virtual machines, CPUs without RAPL) or not readable,
+// since newer kernels restrict the counters to root. It is only
+// supported on Linux.
+func PowerDrawMeasurement() func() (string, error) {
+	return newSampler(readRAPL, powerDraw)
+}
+
+// NewPowerDrawSensor creates a sensor reporting the power draw of the
+// CPU packages in watts (see PowerDrawMeasurement) as resource.
+func NewPowerDrawSensor(resource string) Sensor {
+	return NewSensor(resource, PowerDrawMeasurement())
+}
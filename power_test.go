@@ -0,0 +1,45 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPowerDraw(t *testing.T) {
+	zone := "/sys/class/powercap/intel-rapl:0"
+	previous := map[string]raplCounter{zone: {energy: 1000, maxEnergy: 1 << 32}}
+	tests := []struct {
+		current map[string]raplCounter
+		elapsed time.Duration
+		value   string
+		valid   bool
+	}{
+		{map[string]raplCounter{zone: {energy: 1000 + 25e6, maxEnergy: 1 << 32}}, time.Second, "25.0", true},
+		// the counter wrapped around at its energy range
+		{map[string]raplCounter{zone: {energy: 500, maxEnergy: 1000 + 10e6}}, 2 * time.Second, "5.0", true},
+		{map[string]raplCounter{zone: {energy: 2000, maxEnergy: 1 << 32}}, 0, "", false},
+		{map[string]raplCounter{zone + ":1": {energy: 2000, maxEnergy: 1 << 32}}, time.Second, "", false},
+	}
+	for i, test := range tests {
+		value, err := powerDraw(previous, test.current, test.elapsed)
+		if (err == nil) != test.valid || value != test.value {
+			t.Errorf("test %d: expected %q, got %q, %v", i, test.value, value, err)
+		}
+	}
+}
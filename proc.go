@@ -0,0 +1,46 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// ErrUnsupportedPlatform is returned by measurements which rely on
+// Linux specific interfaces like /proc or /sys on other platforms.
+var ErrUnsupportedPlatform = errors.New("measurement is not supported on this platform")
+
+// requireLinux returns an error wrapping ErrUnsupportedPlatform when
+// not running on Linux.
+func requireLinux() error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("%w (%s)", ErrUnsupportedPlatform, runtime.GOOS)
+	}
+	return nil
+}
+
+// readProcFile reads a file below /proc or /sys after checking that
+// the platform provides these file systems.
+func readProcFile(path string) ([]byte, error) {
+	if err := requireLinux(); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
@@ -0,0 +1,162 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ProcessMatch defines how ProcessCountMeasurement matches processes.
+type ProcessMatch int
+
+const (
+	// MatchExact matches processes whose name is exactly the given
+	// name. The name is the command name of the process (comm) or,
+	// since the kernel truncates it to 15 characters, the base name of
+	// the executable in its command line.
+	MatchExact ProcessMatch = iota
+	// MatchSubstring matches processes whose full command line
+	// (including the arguments, separated by spaces) contains the
+	// given name.
+	MatchSubstring
+)
+
+// processMatches checks a single process. All errors are treated as
+// no match since the process can exit at any time during the scan.
+func processMatches(dir, name string, mode ProcessMatch) bool {
+	cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+	if err != nil {
+		return false
+	}
+	args := strings.Split(string(bytes.TrimRight(cmdline, "\x00")), "\x00")
+	if mode == MatchSubstring {
+		return strings.Contains(strings.Join(args, " "), name)
+	}
+	comm, err := os.ReadFile(filepath.Join(dir, "comm"))
+	if err != nil {
+		return false
+	}
+	if strings.TrimSpace(string(comm)) == name {
+		return true
+	}
+	return args[0] != "" && filepath.Base(args[0]) == name
+}
+
+// ProcessCountMeasurement returns a measurement function reporting the
+// number of running processes matching name (see ProcessMatch) by
+// scanning /proc. Processes which exit during the scan or which can
+// not be read are not counted. When no process matches 0 is reported,
+// an error is only returned when /proc can not be read. Kernel threads
+// have no command line and are never counted. It is only supported on
+// Linux.
+func ProcessCountMeasurement(name string, mode ProcessMatch) func() (string, error) {
+	return func() (string, error) {
+		if err := requireLinux(); err != nil {
+			return "", err
+		}
+		entries, err := os.ReadDir("/proc")
+		if err != nil {
+			return "", err
+		}
+		count := 0
+		for _, entry := range entries {
+			if _, err := strconv.Atoi(entry.Name()); err != nil || !entry.IsDir() {
+				continue
+			}
+			if processMatches(filepath.Join("/proc", entry.Name()), name, mode) {
+				count++
+			}
+		}
+		return strconv.Itoa(count), nil
+	}
+}
+
+// NewProcessCountSensor creates a sensor reporting the number of
+// processes matching name (see ProcessCountMeasurement) as resource.
+func NewProcessCountSensor(resource, name string, mode ProcessMatch) Sensor {
+	return NewSensor(resource, ProcessCountMeasurement(name, mode))
+}
+
+// processState returns the state of a process from its stat file
+// (see parseStatState).
+func processState(dir string) (byte, error) {
+	content, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return 0, err
+	}
+	state, err := parseStatState(content)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s/stat: %w", dir, err)
+	}
+	return state, nil
+}
+
+// parseStatState returns the state of a process (field 3 of its stat
+// file, like 'R', 'S' or 'Z'). The command name in the second field is
+// enclosed in parentheses and can itself contain spaces and
+// parentheses, like "(my (odd) app)", so the state is the first field
+// after the last closing parenthesis.
+func parseStatState(content []byte) (byte, error) {
+	end := bytes.LastIndexByte(content, ')')
+	if end < 0 {
+		return 0, errors.New("no command name")
+	}
+	fields := strings.Fields(string(content[end+1:]))
+	if len(fields) == 0 || len(fields[0]) != 1 {
+		return 0, errors.New("no process state")
+	}
+	return fields[0][0], nil
+}
+
+// ZombieProcessCountMeasurement reports the number of zombie (defunct)
+// processes, which exited but were not reaped by their parent, by
+// scanning the stat files of /proc. A rising number hints at a
+// misbehaving application or a stuck parent process. No zombies are
+// reported as 0, an error is only returned when /proc can not be read.
+// Processes which exit during the scan are not counted. It is only
+// supported on Linux.
+func ZombieProcessCountMeasurement() (string, error) {
+	if err := requireLinux(); err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return "", err
+	}
+	count := 0
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil || !entry.IsDir() {
+			continue
+		}
+		if state, err := processState(filepath.Join("/proc", entry.Name())); err == nil && state == 'Z' {
+			count++
+		}
+	}
+	return strconv.Itoa(count), nil
+}
+
+// NewZombieProcessSensor creates a sensor reporting the number of
+// zombie processes (see ZombieProcessCountMeasurement) as resource.
+func NewZombieProcessSensor(resource string) Sensor {
+	return NewSensor(resource, ZombieProcessCountMeasurement)
+}
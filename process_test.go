@@ -0,0 +1,50 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import "testing"
+
+func TestParseStatState(t *testing.T) {
+	tests := []struct {
+		stat  string
+		state byte
+		valid bool
+	}{
+		{"1 (systemd) S 0 1 1 0 -1 4194560 52763 7327410", 'S', true},
+		{"4242 (my app) R 1 4242 4242 0 -1", 'R', true},
+		{"4243 (my (odd) app) Z 1 4243", 'Z', true},
+		{"4244 (a) b) D 1 4244", 'D', true},
+		{"4245 ()) T 1", 'T', true},
+		{"4246 (sleep) S", 'S', true},
+		// truncated lines
+		{"", 0, false},
+		{"4247 (truncat", 0, false},
+		{"4248 (sleep)", 0, false},
+		{"4249 (sleep)   \n", 0, false},
+		{"4250 (sleep) SS 1", 0, false},
+	}
+	for _, test := range tests {
+		state, err := parseStatState([]byte(test.stat))
+		if (err == nil) != test.valid {
+			t.Errorf("%q: unexpected error %v", test.stat, err)
+			continue
+		}
+		if state != test.state {
+			t.Errorf("%q: expected state %q, got %q", test.stat, test.state, state)
+		}
+	}
+}
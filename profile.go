@@ -0,0 +1,60 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+// ProfileEnv is the environment variable containing the active profile
+// of a new context (see Sensor.Profiles).
+const ProfileEnv = "LOADSENSOR_PROFILE"
+
+// WithProfile sets the active profile of the context, overriding the
+// one of the environment variable ProfileEnv. Only sensors for this
+// profile are measured (see Sensor.Profiles). An empty profile measures
+// all sensors. A warning is logged when no sensor is selected.
+func WithProfile(profile string) Option {
+	return func(ctx *Context) {
+		ctx.profile = profile
+		ctx.checkProfile()
+	}
+}
+
+// profileSelected checks if the sensor is measured with the active
+// profile.
+func (ctx *Context) profileSelected(sensor Sensor) bool {
+	if ctx.profile == "" || len(sensor.Profiles) == 0 {
+		return true
+	}
+	for _, profile := range sensor.Profiles {
+		if profile == ctx.profile {
+			return true
+		}
+	}
+	return false
+}
+
+// checkProfile logs a warning when the active profile selects none of
+// the sensors.
+func (ctx *Context) checkProfile() {
+	if ctx.profile == "" || len(ctx.sensors) == 0 {
+		return
+	}
+	for _, sensor := range ctx.sensors {
+		if ctx.profileSelected(sensor) {
+			return
+		}
+	}
+	ctx.logf("warning: profile %q selects none of the %d sensors", ctx.profile, len(ctx.sensors))
+}
@@ -0,0 +1,116 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// ProtocolWriter writes the values of a load report in the wire format
+// of the Grid Engine version the load sensor reports to. The context
+// writes the begin and end lines and calls the ProtocolWriter for each
+// value in between with a buffer, the complete load report is written
+// with a single Write call afterwards. Lines are terminated with "\n",
+// which is replaced by the line ending of the context (see
+// WithLineEnding). A returned error drops the line from the load
+// report and is logged.
+type ProtocolWriter interface {
+	// WriteValue writes the lines reporting value as the load value
+	// of resource on host.
+	WriteValue(w io.Writer, host, resource, value string) error
+	// ClearValue writes the lines removing a previously reported value
+	// of resource on host (see ErrClear).
+	ClearValue(w io.Writer, host, resource string) error
+}
+
+// LineProtocol is the ProtocolWriter for the load sensor protocol of
+// all current Grid Engine versions and lineages: each value is a line
+// host:resource:value. The protocol has no line removing a value, a
+// value can only be omitted from the load report, so ClearValue writes
+// nothing and Grid Engine keeps the previous value until it expires.
+type LineProtocol struct{}
+
+func (LineProtocol) WriteValue(w io.Writer, host, resource, value string) error {
+	_, err := io.WriteString(w, host+":"+resource+":"+value+"\n")
+	return err
+}
+
+func (LineProtocol) ClearValue(w io.Writer, host, resource string) error {
+	return nil
+}
+
+// WithProtocolWriter sets the ProtocolWriter formatting the values of
+// the load reports, for example for a Grid Engine version which
+// expects an explicit line for removed values. The default is
+// LineProtocol. The report sinks always receive the values in their
+// own format (see WithSinkFormat).
+func WithProtocolWriter(p ProtocolWriter) Option {
+	return func(ctx *Context) {
+		ctx.protocol = p
+	}
+}
+
+// protocolLine returns the lines written by f with the line ending of
+// the context.
+func (ctx *Context) protocolLine(f func(p ProtocolWriter, w io.Writer) error) string {
+	p := ctx.protocol
+	if p == nil {
+		p = LineProtocol{}
+	}
+	var buf bytes.Buffer
+	if err := f(p, &buf); err != nil {
+		ctx.logf("error writing load report line: %s", err)
+		return ""
+	}
+	if ctx.lineEnding == "\n" {
+		return buf.String()
+	}
+	return strings.ReplaceAll(buf.String(), "\n", ctx.lineEnding)
+}
+
+// reportLine formats a single value of a load report.
+func (ctx *Context) reportLine(r Report) string {
+	return ctx.protocolLine(func(p ProtocolWriter, w io.Writer) error {
+		return p.WriteValue(w, r.Host, r.Resource, r.Value)
+	})
+}
+
+// clearLine formats the removal of a value of a load report.
+func (ctx *Context) clearLine(r Report) string {
+	return ctx.protocolLine(func(p ProtocolWriter, w io.Writer) error {
+		return p.ClearValue(w, r.Host, r.Resource)
+	})
+}
+
+// formatReport assembles the complete load report including the
+// begin and end lines so that it can be written at once. The values in
+// cleared were removed with ErrClear in this load report.
+func (ctx *Context) formatReport(report, cleared []Report) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("begin" + ctx.lineEnding)
+	for _, r := range report {
+		// load value for resource for the given host
+		buf.WriteString(ctx.reportLine(r))
+	}
+	for _, r := range cleared {
+		buf.WriteString(ctx.clearLine(r))
+	}
+	buf.WriteString("end" + ctx.lineEnding)
+	return buf.Bytes()
+}
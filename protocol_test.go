@@ -0,0 +1,123 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"io"
+	"testing"
+)
+
+func TestLineProtocol(t *testing.T) {
+	ctx, err := Create([]Sensor{
+		testSensor("a", func() (string, error) { return "1", nil }),
+		testSensor("b", func() (string, error) { return "", ErrClear }),
+		testSensor("c", func() (string, error) { return "", ErrSkip }),
+		testSensor("d", func() (string, error) { return "0", nil }),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "begin\nhost:a:1\nhost:d:0\nend\n"
+	if report := runReport(t, ctx); report != expected {
+		t.Errorf("expected %q, got %q", expected, report)
+	}
+}
+
+func TestLineProtocolCRLF(t *testing.T) {
+	ctx, err := CreateWithOptions([]Sensor{
+		testSensor("a", func() (string, error) { return "1", nil }),
+	}, WithLineEnding("\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "begin\r\nhost:a:1\r\nend\r\n"
+	if report := runReport(t, ctx); report != expected {
+		t.Errorf("expected %q, got %q", expected, report)
+	}
+}
+
+func TestInvalidLineEndingIgnored(t *testing.T) {
+	logs := &logRecorder{}
+	ctx, err := CreateWithOptions([]Sensor{
+		testSensor("a", func() (string, error) { return "1", nil }),
+	}, WithLogOutput(logs), WithLineEnding("\r\n"), WithLineEnding("\r"), WithLineEnding(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "begin\r\nhost:a:1\r\nend\r\n"
+	if report := runReport(t, ctx); report != expected {
+		t.Errorf("expected %q, got %q", expected, report)
+	}
+	if n := logs.count("warning: ignoring the invalid line ending"); n != 2 {
+		t.Errorf("expected 2 warnings, got %d: %q", n, logs.logs.String())
+	}
+}
+
+// removalProtocol writes an explicit line for removed values.
+type removalProtocol struct {
+	LineProtocol
+}
+
+func (removalProtocol) ClearValue(w io.Writer, host, resource string) error {
+	_, err := io.WriteString(w, host+":"+resource+":-\n")
+	return err
+}
+
+func TestProtocolWriterClearValue(t *testing.T) {
+	values := []error{nil, ErrClear}
+	call := 0
+	ctx, err := CreateWithOptions([]Sensor{
+		testSensor("a", func() (string, error) {
+			err := values[call]
+			call++
+			return "1", err
+		}),
+		testSensor("b", func() (string, error) { return "2", nil }),
+	}, WithProtocolWriter(removalProtocol{}), WithLineEnding("\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"begin\r\nhost:a:1\r\nhost:b:2\r\nend\r\n",
+		"begin\r\nhost:b:2\r\nhost:a:-\r\nend\r\n",
+	}
+	for i, e := range expected {
+		if report := runReport(t, ctx); report != e {
+			t.Errorf("report %d: expected %q, got %q", i, e, report)
+		}
+	}
+}
+
+func TestClearStatus(t *testing.T) {
+	values := []error{nil, ErrClear}
+	call := 0
+	ctx, err := Create([]Sensor{testSensor("a", func() (string, error) {
+		err := values[call]
+		call++
+		return "1", err
+	})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runReport(t, ctx)
+	if report := runReport(t, ctx); report != "begin\nend\n" {
+		t.Errorf("cleared value was reported: %q", report)
+	}
+	if status := ctx.Status(); status.Sensors[0].Value != "" {
+		t.Errorf("cleared value is still in the status: %q", status.Sensors[0].Value)
+	}
+}
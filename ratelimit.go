@@ -0,0 +1,115 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the combined rate of the measurements of several
+// sensors querying the same backend, like a license server or a REST
+// API with a request limit (see Limited). It is a token bucket which
+// holds up to one second worth of tokens, so that a short burst after
+// an idle time is allowed while the average rate stays at the limit.
+// A RateLimiter is safe for concurrent use.
+type RateLimiter struct {
+	mutex  sync.Mutex
+	clock  Clock
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a RateLimiter allowing rps calls per second
+// on average. A rate below one call per second allows a burst of a
+// single call.
+func NewRateLimiter(rps float64) *RateLimiter {
+	burst := rps
+	if burst < 1 {
+		burst = 1
+	}
+	clock := currentClock()
+	return &RateLimiter{clock: clock, rate: rps, burst: burst, tokens: burst, last: clock.Now()}
+}
+
+// Wait blocks until the limiter allows the next call or c is done. An
+// error is returned without waiting when the deadline of c expires
+// before a call would be allowed. A limiter with a rate which is not
+// positive never allows a call.
+func (l *RateLimiter) Wait(c context.Context) error {
+	if l.rate <= 0 {
+		<-c.Done()
+		return c.Err()
+	}
+	l.mutex.Lock()
+	now := l.clock.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	// the token is reserved, so concurrent callers wait in order
+	l.tokens--
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mutex.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	if deadline, ok := c.Deadline(); ok && now.Add(wait).After(deadline) {
+		l.release()
+		return fmt.Errorf("rate limit: next call allowed in %s after the deadline: %w", wait, context.DeadlineExceeded)
+	}
+	select {
+	case <-l.clock.After(wait):
+		return nil
+	case <-c.Done():
+		l.release()
+		return c.Err()
+	}
+}
+
+// release returns a reserved token which was not used. The bucket
+// never holds more than the burst.
+func (l *RateLimiter) release() {
+	l.mutex.Lock()
+	if l.tokens++; l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.mutex.Unlock()
+}
+
+// Limited returns a context aware measurement function which waits for
+// the limiter before each call of f (see RateLimiter.Wait). When the
+// load report is aborted or the wait would exceed the deadline of the
+// context, f is not called and the error is returned. Sensors sharing
+// a limiter are limited together, independent of their Interval and
+// of how they are scheduled (see WithParallelism).
+func Limited(limiter *RateLimiter, f func() (string, error)) func(context.Context) (string, error) {
+	return func(c context.Context) (string, error) {
+		if c == nil {
+			c = context.Background()
+		}
+		if err := limiter.Wait(c); err != nil {
+			return "", err
+		}
+		return f()
+	}
+}
@@ -0,0 +1,126 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestLimiter creates a limiter using a FakeClock.
+func newTestLimiter(t *testing.T, rps float64) (*RateLimiter, *FakeClock) {
+	clock := NewFakeClock(testStart)
+	SetDefaultClock(clock)
+	t.Cleanup(func() { SetDefaultClock(nil) })
+	return NewRateLimiter(rps), clock
+}
+
+// waitAsync calls Wait in a goroutine.
+func waitAsync(c context.Context, l *RateLimiter) <-chan error {
+	result := make(chan error, 1)
+	go func() { result <- l.Wait(c) }()
+	return result
+}
+
+// expectImmediate checks that Wait returns without waiting.
+func expectImmediate(t *testing.T, l *RateLimiter) {
+	t.Helper()
+	select {
+	case err := <-waitAsync(context.Background(), l):
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Wait blocked")
+	}
+}
+
+// expectWait checks that Wait returns after the FakeClock advanced by
+// d, but not before.
+func expectWait(t *testing.T, l *RateLimiter, clock *FakeClock, d time.Duration) {
+	t.Helper()
+	result := waitAsync(context.Background(), l)
+	clock.BlockUntil(1)
+	clock.Advance(d - time.Millisecond)
+	select {
+	case <-result:
+		t.Fatalf("Wait returned before %s", d)
+	default:
+	}
+	clock.Advance(time.Millisecond)
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRateLimiterBurstAndRate(t *testing.T) {
+	l, clock := newTestLimiter(t, 2)
+	expectImmediate(t, l)
+	expectImmediate(t, l)
+	expectWait(t, l, clock, 500*time.Millisecond)
+	expectWait(t, l, clock, 500*time.Millisecond)
+	// an idle time refills the bucket up to the burst only
+	clock.Advance(time.Hour)
+	expectImmediate(t, l)
+	expectImmediate(t, l)
+	expectWait(t, l, clock, 500*time.Millisecond)
+}
+
+func TestRateLimiterSlowRate(t *testing.T) {
+	l, clock := newTestLimiter(t, 0.1)
+	expectImmediate(t, l)
+	expectWait(t, l, clock, 10*time.Second)
+}
+
+func TestRateLimiterDeadline(t *testing.T) {
+	l, clock := newTestLimiter(t, 1)
+	expectImmediate(t, l)
+	c, cancel := context.WithDeadline(context.Background(), testStart.Add(500*time.Millisecond))
+	defer cancel()
+	if err := l.Wait(c); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+	// the rejected call did not use a token
+	clock.Advance(time.Second)
+	expectImmediate(t, l)
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	l, clock := newTestLimiter(t, 1)
+	expectImmediate(t, l)
+	c, cancel := context.WithCancel(context.Background())
+	result := waitAsync(c, l)
+	clock.BlockUntil(1)
+	cancel()
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	// the token of the cancelled call is available again
+	clock.Advance(time.Second)
+	expectImmediate(t, l)
+	expectWait(t, l, clock, time.Second)
+}
+
+func TestRateLimiterReleaseKeepsBurst(t *testing.T) {
+	l, _ := newTestLimiter(t, 3)
+	l.release()
+	if l.tokens != l.burst {
+		t.Errorf("release filled the bucket to %v tokens, the burst is %v", l.tokens, l.burst)
+	}
+}
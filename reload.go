@@ -0,0 +1,103 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// WithReload lets Run reload the sensors on SIGHUP: reload is called
+// to create the new sensors, for example from a configuration file.
+// When it succeeds and all sensors are valid (see Create) the sensors
+// of the context are replaced before the next load report, together
+// with their Status and ReportOnChange state, and WithDefaultInterval
+// applies to them like to the sensors given to Create. A load report
+// which is running when the signal arrives is completed with the old
+// sensors. With WithBackgroundMeasurement the background measurements
+// of the old sensors are stopped before the sensors are replaced. When
+// reload fails, returns no sensors or returns invalid sensors the
+// error is logged and the old sensors are kept. Without this option
+// SIGHUP is not handled.
+func WithReload(reload func() ([]Sensor, error)) Option {
+	return func(ctx *Context) {
+		ctx.reload = reload
+	}
+}
+
+// watchReload calls the reload function on each SIGHUP until done is
+// closed and stores valid sensors for the next load report.
+func (ctx *Context) watchReload(done <-chan struct{}) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-done:
+			return
+		case <-signals:
+		}
+		sensors, err := ctx.reload()
+		if err == nil && len(sensors) == 0 {
+			err = errors.New("no sensors")
+		}
+		if err == nil {
+			for i := range sensors {
+				if errSensor := validateSensor(sensors[i]); errSensor != nil {
+					err = fmt.Errorf("sensor %d: %w", i, errSensor)
+					break
+				}
+			}
+		}
+		if err != nil {
+			ctx.logf("reload failed, keeping the current sensors: %s", err)
+			continue
+		}
+		ctx.mutex.Lock()
+		ctx.reloaded = sensors
+		ctx.mutex.Unlock()
+		ctx.logf("reloaded %d sensors", len(sensors))
+	}
+}
+
+// reloadPending returns true when there are reloaded sensors which
+// were not applied yet.
+func (ctx *Context) reloadPending() bool {
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	return ctx.reloaded != nil
+}
+
+// applyReload replaces the sensors of the context with the reloaded
+// ones. It must only be called between load reports while no
+// background measurement is running and returns false when there are
+// no reloaded sensors.
+func (ctx *Context) applyReload() bool {
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	if ctx.reloaded == nil {
+		return false
+	}
+	s := withDefaultInterval(ctx.reloaded, ctx.defaultInterval)
+	ctx.reloaded = nil
+	ctx.sensors, ctx.stats, ctx.states = s, newSensorStatus(s), make([]sensorState, len(s))
+	ctx.reportOffset = 0
+	return true
+}
@@ -0,0 +1,74 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrReplayExhausted is returned by a replay sensor with ReplayStop
+// after all values were reported.
+var ErrReplayExhausted = errors.New("all replay values reported")
+
+// ReplayMode defines what a replay sensor reports after the last of
+// its values.
+type ReplayMode int
+
+const (
+	// ReplayRepeatLast reports the last value again in each following
+	// load report.
+	ReplayRepeatLast ReplayMode = iota
+	// ReplayCycle starts over with the first value.
+	ReplayCycle
+	// ReplayStop makes each following measurement fail with
+	// ErrReplayExhausted so that no value is reported.
+	ReplayStop
+)
+
+// NewReplaySensor creates a sensor for the local host which reports
+// the given values as resource in order, one value per measurement,
+// instead of measuring anything. It is meant for deterministic tests
+// of the load reports, for example with RunOnce or RunN and a golden
+// file. What is reported after the last value is defined by mode. An
+// empty value is omitted from its load report like for every other
+// sensor, a sensor without values fails like ReplayStop.
+func NewReplaySensor(resource string, values []string, mode ReplayMode) Sensor {
+	values = append([]string(nil), values...)
+	var mutex sync.Mutex
+	next := 0
+	return NewSensor(resource, func() (string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if len(values) == 0 {
+			return "", ErrReplayExhausted
+		}
+		if next == len(values) {
+			switch mode {
+			case ReplayCycle:
+				next = 0
+			case ReplayStop:
+				return "", ErrReplayExhausted
+			default:
+				return values[len(values)-1], nil
+			}
+		}
+		value := values[next]
+		next++
+		return value, nil
+	})
+}
@@ -0,0 +1,83 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// replay returns the results of n measurements of a replay sensor,
+// failures as "!".
+func replay(values []string, mode ReplayMode, n int) (string, error) {
+	measure := NewReplaySensor("r", values, mode).MeasurementFunction
+	var results []string
+	var last error
+	for i := 0; i < n; i++ {
+		value, err := measure()
+		if err != nil {
+			value, last = "!", err
+		}
+		results = append(results, value)
+	}
+	return strings.Join(results, " "), last
+}
+
+func TestReplaySensor(t *testing.T) {
+	tests := []struct {
+		values   []string
+		mode     ReplayMode
+		expected string
+	}{
+		{[]string{"1", "2", "3"}, ReplayRepeatLast, "1 2 3 3 3"},
+		{[]string{"1", "2", "3"}, ReplayCycle, "1 2 3 1 2"},
+		{[]string{"1", "2", "3"}, ReplayStop, "1 2 3 ! !"},
+		{[]string{"1", "", "3"}, ReplayCycle, "1  3 1 "},
+		{nil, ReplayRepeatLast, "! ! ! ! !"},
+		{nil, ReplayCycle, "! ! ! ! !"},
+		{nil, ReplayStop, "! ! ! ! !"},
+	}
+	for _, test := range tests {
+		results, err := replay(test.values, test.mode, 5)
+		if results != test.expected {
+			t.Errorf("%q with mode %d: expected %q, got %q", test.values, test.mode, test.expected, results)
+		}
+		if err != nil && !errors.Is(err, ErrReplayExhausted) {
+			t.Errorf("%q with mode %d: unexpected error %v", test.values, test.mode, err)
+		}
+	}
+}
+
+func TestReplaySensorReports(t *testing.T) {
+	values := []string{"1", "", "3"}
+	s := NewReplaySensor("r", values, ReplayStop)
+	s.HostNameFunction = func() (string, error) { return "host", nil }
+	values[0] = "changed"
+	ctx, err := CreateWithOptions([]Sensor{s}, WithLogOutput(&logRecorder{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reports []string
+	for i := 0; i < 4; i++ {
+		reports = append(reports, runReport(t, ctx))
+	}
+	expected := []string{"begin\nhost:r:1\nend\n", "begin\nend\n", "begin\nhost:r:3\nend\n", "begin\nend\n"}
+	if strings.Join(reports, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %q, got %q", expected, reports)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import "sort"
+
+// WithLineEnding sets the line terminator of the load reports written
+// by the context, for example "\r\n" for consumers expecting CRLF. The
+// default is "\n". Other line endings are rejected: they are logged as
+// warning and the current line ending is kept. Commands read from the
+// input are accepted with both line endings independent of this
+// setting.
+func WithLineEnding(s string) Option {
+	return func(ctx *Context) {
+		if s != "\n" && s != "\r\n" {
+			ctx.logf("warning: ignoring the invalid line ending %q, load reports end lines with %q", s, ctx.lineEnding)
+			return
+		}
+		ctx.lineEnding = s
+	}
+}
+
+// reportFraming is the size of the begin and end lines of a report.
+func reportFraming(eol string) int {
+	return len("begin") + len("end") + 2*len(eol)
+}
+
+// WithMaxReportSize limits the size of a single load report in bytes
+// (including the begin and end lines). When the values of a load
+// report exceed the limit only as many values as fit into the limit
+// are reported, at least one. The next load report continues with the
+// following values and wraps around at the end, so that with hundreds
+// of values every value is reported round robin over several load
+// report intervals. All sensors are still measured in each load
+// report. Values which are not contained in a report keep their
+// previous value in Grid Engine, hence the limit should be chosen so
+// that a full round takes less time than the values need to expire.
+// Zero (the default) disables the limit.
+func WithMaxReportSize(bytes int) Option {
+	return func(ctx *Context) {
+		ctx.maxReportSize = bytes
+	}
+}
+
+// splitReport returns the part of the report which is written in the
+// current load report according to the maximum report size.
+func (ctx *Context) splitReport(report []Report) []Report {
+	if ctx.maxReportSize <= 0 || len(report) == 0 {
+		return report
+	}
+	size := reportFraming(ctx.lineEnding)
+	for _, r := range report {
+		size += len(ctx.reportLine(r))
+	}
+	if size <= ctx.maxReportSize {
+		return report
+	}
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	start := ctx.reportOffset % len(report)
+	size = reportFraming(ctx.lineEnding)
+	var part []Report
+	for i := 0; i < len(report); i++ {
+		r := report[(start+i)%len(report)]
+		lineSize := len(ctx.reportLine(r))
+		if len(part) > 0 && size+lineSize > ctx.maxReportSize {
+			break
+		}
+		part = append(part, r)
+		size += lineSize
+	}
+	ctx.reportOffset = (start + len(part)) % len(report)
+	return part
+}
+
+// WithGroupByHost sorts the values of each load report by host and
+// the values of each host by resource, so that all lines of a host
+// are written together. This makes load reports of multi-host sensors
+// (see NewMultiHostSensor) deterministic, whose values otherwise appear
+// in the order of the sensors and, with WithParallelism, can interleave
+// hosts. The values are sorted after all sensors completed and the
+// report was limited by WithMaxReportSize, right before it is written.
+// By default the values are written in the order of the sensors.
+func WithGroupByHost() Option {
+	return func(ctx *Context) {
+		ctx.groupByHost = true
+	}
+}
+
+// groupReport sorts the report by host and resource when
+// WithGroupByHost is set.
+func (ctx *Context) groupReport(report []Report) []Report {
+	if !ctx.groupByHost {
+		return report
+	}
+	grouped := append([]Report(nil), report...)
+	sort.SliceStable(grouped, func(i, j int) bool {
+		if grouped[i].Host != grouped[j].Host {
+			return grouped[i].Host < grouped[j].Host
+		}
+		return grouped[i].Resource < grouped[j].Resource
+	})
+	return grouped
+}
@@ -0,0 +1,74 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// restartStateVersion is the version of the state file of the restart
+// counter. Version 0 is the plain number of starts.
+const restartStateVersion = 1
+
+// restartState is the content of the state file of the restart counter.
+type restartState struct {
+	Starts uint64 `json:"starts"`
+}
+
+// restartMigrations migrate older state files of the restart counter.
+var restartMigrations = map[int]StateMigration{
+	0: func(data []byte) ([]byte, error) {
+		starts, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(restartState{Starts: starts})
+	},
+}
+
+// WithRestartCounter counts the starts of the load sensor in the state
+// file at path (see SaveState), which is updated each time Run starts,
+// and reports the number of restarts (the starts before the current
+// one) as the given restarts resource of the local host, so that a
+// crash loop becomes visible in qhost. The uptime of the process in
+// seconds is reported as the given uptime resource. An empty resource
+// name omits the value. A missing state file starts the count at zero,
+// a state file which can not be used is reset to zero with a warning.
+func WithRestartCounter(path, restarts, uptime string) Option {
+	return func(ctx *Context) {
+		ctx.restartFile, ctx.restartsResource, ctx.uptimeResource = path, restarts, uptime
+	}
+}
+
+// countStart increments the number of starts in the state file and
+// remembers the number of restarts.
+func (ctx *Context) countStart() {
+	var state restartState
+	if _, err := LoadState(ctx.restartFile, restartStateVersion, restartMigrations, &state); err != nil {
+		ctx.logf("can not use restart counter: %s", err)
+		state = restartState{}
+	}
+	state.Starts++
+	if err := SaveState(ctx.restartFile, restartStateVersion, state); err != nil {
+		ctx.logf("can not write restart counter: %s", err)
+	}
+	ctx.mutex.Lock()
+	ctx.restarts = state.Starts - 1
+	ctx.mutex.Unlock()
+}
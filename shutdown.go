@@ -0,0 +1,102 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"context"
+	"io"
+)
+
+// OnShutdown registers a function which is called when Run stops,
+// either because "quit" was received or because stdin was closed.
+// It is meant for process wide resources shared by several sensors,
+// like state files which need to be flushed or database connections.
+// The functions are called in reverse order of their registration
+// (like defer) after the last load report, including the final report
+// of WithFinalReport, was written. Errors are
+// logged to stderr and do not stop the remaining functions.
+func (ctx *Context) OnShutdown(f func() error) {
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	ctx.shutdown = append(ctx.shutdown, f)
+}
+
+// runShutdown calls all functions registered with OnShutdown in
+// reverse order.
+func (ctx *Context) runShutdown() {
+	ctx.mutex.Lock()
+	funcs := ctx.shutdown
+	ctx.shutdown = nil
+	ctx.mutex.Unlock()
+	for i := len(funcs) - 1; i >= 0; i-- {
+		if err := funcs[i](); err != nil {
+			ctx.logf("error during shutdown: %s", err)
+		}
+	}
+}
+
+// FinalReport defines the load report a context writes when Run
+// stops (see WithFinalReport).
+type FinalReport int
+
+const (
+	// FinalReportNone writes no final report, Grid Engine keeps the
+	// values of the previous load report until they expire.
+	FinalReportNone FinalReport = iota
+	// FinalReportDrainValues writes a load report containing only the
+	// values set with WithDrainValues, so that the host stops
+	// accepting jobs.
+	FinalReportDrainValues
+	// FinalReportValues measures all sensors once more and writes a
+	// regular load report. It contains the values of sensors with
+	// ReportOnChange even when they did not change.
+	FinalReportValues
+)
+
+// WithFinalReport makes Run write one last load report when it stops
+// because "quit" was received, stdin was closed or the limit of
+// WithMaxCycles was reached, so that the last state of the host in
+// Grid Engine is defined by the load sensor instead of by whatever
+// the previous load report contained. The report is written to the
+// output of the context and to the report sinks and hooks before the
+// functions registered with OnShutdown are called, so for example a
+// DailyLogWriter still receives it. A report aborted by "quit" is not
+// retried, the final report is written instead. The execd reads load
+// reports only when it requested one, so depending on the Grid Engine
+// version the final report may only reach the sinks. The default is
+// FinalReportNone.
+func WithFinalReport(final FinalReport) Option {
+	return func(ctx *Context) {
+		ctx.finalReport = final
+	}
+}
+
+// finalCycle writes the final load report of WithFinalReport.
+func (ctx *Context) finalCycle(w io.Writer) {
+	var err error
+	switch ctx.finalReport {
+	case FinalReportNone:
+		return
+	case FinalReportDrainValues:
+		err = ctx.maintenanceCycle(w, MaintenanceDrainValues)
+	case FinalReportValues:
+		err = ctx.cycle(context.Background(), w, true)
+	}
+	if err != nil {
+		ctx.logf("error writing final load report: %s", err)
+	}
+}
@@ -0,0 +1,153 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// WithReportSink adds a secondary output which receives a copy of
+// each load report for debugging. It is never part of the Grid Engine
+// protocol stream, so each value is annotated with the time it was
+// measured in a comment:
+//
+//	begin
+//	host:resource:value # measured 2016-01-02T15:04:05.000Z
+//	host:resource:value # measured 2016-01-02T15:02:05.000Z stale 2m0s
+//	end
+//
+// Values served from a cache show the time of the original
+// measurement and their age when they are stale (see
+// WithStaleThreshold). Values of shadow sensors (see Sensor.Shadow),
+// which are not part of the load report, are marked with "shadow".
+// Labels of the sensor (see Sensor.Labels) are
+// appended to the comment in key order like "# measured ... labels
+// dc=east". Errors writing to the sink are logged.
+func WithReportSink(w io.Writer) Option {
+	return func(ctx *Context) {
+		if w != nil {
+			ctx.sinks = append(ctx.sinks, w)
+		}
+	}
+}
+
+// SinkFormat defines how load reports are written to the report sinks
+// (see WithReportSink and WithDailyReportLog). It never affects the
+// load reports written to Grid Engine.
+type SinkFormat int
+
+const (
+	// SinkAnnotated writes the protocol lines each followed by a
+	// comment with the measurement time and labels (the default).
+	SinkAnnotated SinkFormat = iota
+	// SinkTable writes each load report as a table with aligned
+	// columns for host, resource, value, measurement time, the age of
+	// stale values and labels which is easier to read for operators:
+	//
+	//	HOST   RESOURCE  VALUE  MEASURED                  AGE   LABELS
+	//	node1  load      0.5    2016-01-02T15:04:05.000Z        dc=east
+	//	node1  lic_free  3      2016-01-02T15:02:05.000Z  2m0s
+	//
+	// Load reports are separated by an empty line.
+	SinkTable
+)
+
+// WithSinkFormat sets the format of the load reports written to the
+// report sinks. The default is SinkAnnotated.
+func WithSinkFormat(f SinkFormat) Option {
+	return func(ctx *Context) {
+		ctx.sinkFormat = f
+	}
+}
+
+// sinkTime formats the measurement time of a value for the sinks.
+func sinkTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+// sinkLabels formats labels in key order like "dc=east,team=hpc".
+func sinkLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		keys[i] = key + "=" + labels[key]
+	}
+	return strings.Join(keys, ",")
+}
+
+// formatSinkReport formats a load report for the report sinks.
+func formatSinkReport(report []Report, format SinkFormat) []byte {
+	var buf bytes.Buffer
+	if format == SinkTable {
+		tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "HOST\tRESOURCE\tVALUE\tMEASURED\tAGE\tLABELS")
+		for _, r := range report {
+			value, age := r.Value, ""
+			if r.Shadow {
+				value += " (shadow)"
+			}
+			if r.Stale {
+				age = r.Age.Round(time.Second).String()
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Host, r.Resource, value,
+				sinkTime(r.MeasuredAt), age, sinkLabels(r.Labels))
+		}
+		tw.Flush()
+		buf.WriteString("\n")
+		return buf.Bytes()
+	}
+	buf.WriteString("begin\n")
+	for _, r := range report {
+		fmt.Fprintf(&buf, "%s:%s:%s # measured %s", r.Host, r.Resource, r.Value, sinkTime(r.MeasuredAt))
+		if r.Stale {
+			fmt.Fprintf(&buf, " stale %s", r.Age.Round(time.Second))
+		}
+		if r.Shadow {
+			buf.WriteString(" shadow")
+		}
+		if len(r.Labels) > 0 {
+			buf.WriteString(" labels " + sinkLabels(r.Labels))
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("end\n")
+	return buf.Bytes()
+}
+
+// writeSinks writes the load report to all report sinks and queues it
+// for the async report hooks (see WithAsyncReportHook).
+func (ctx *Context) writeSinks(report []Report) {
+	ctx.queueHooks(report)
+	if len(ctx.sinks) == 0 {
+		return
+	}
+	out := formatSinkReport(report, ctx.sinkFormat)
+	for _, sink := range ctx.sinks {
+		if _, err := sink.Write(out); err != nil {
+			ctx.logf("error writing to report sink: %s", err)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import "strconv"
+
+// FreeSlotsMeasurement returns a measurement function reporting the
+// number of free slots as integer: total minus the number of slots in
+// use returned by inUse. More slots in use than available are reported
+// as 0 instead of a negative value. When inUse fails its error is
+// returned and no value is reported in that load report.
+func FreeSlotsMeasurement(total int, inUse func() (int, error)) func() (string, error) {
+	return func() (string, error) {
+		used, err := inUse()
+		if err != nil {
+			return "", err
+		}
+		free := total - used
+		if free < 0 {
+			free = 0
+		}
+		return strconv.Itoa(free), nil
+	}
+}
+
+// NewSlotSensor creates a sensor reporting the number of free slots
+// of a custom slot accounting as resource (see FreeSlotsMeasurement).
+func NewSlotSensor(resource string, total int, inUse func() (int, error)) Sensor {
+	return NewSensor(resource, FreeSlotsMeasurement(total, inUse))
+}
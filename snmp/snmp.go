@@ -0,0 +1,368 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package snmp provides sensors which report values polled from
+// appliances via SNMP. It implements the SNMP GET request of SNMPv2c
+// (RFC 3416) on top of the standard library and is a separate package
+// so that load sensors which do not need it are not linked against the
+// network code.
+package snmp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgruber/loadsensor"
+)
+
+// Timeout is the maximum time to wait for the response of an agent.
+// A request is sent once without retries, so an unreachable agent
+// makes the measurement fail after Timeout and the value is omitted
+// from the load report. Changes affect all following requests.
+var Timeout = 2 * time.Second
+
+// BER tags used by SNMP (see RFC 3416 and RFC 2578).
+const (
+	tagInteger        = 0x02
+	tagOctetString    = 0x04
+	tagNull           = 0x05
+	tagOID            = 0x06
+	tagSequence       = 0x30
+	tagIPAddress      = 0x40
+	tagCounter32      = 0x41
+	tagGauge32        = 0x42
+	tagTimeTicks      = 0x43
+	tagCounter64      = 0x46
+	tagNoSuchObject   = 0x80
+	tagNoSuchInstance = 0x81
+	tagEndOfMibView   = 0x82
+	tagGetRequest     = 0xa0
+	tagResponse       = 0xa2
+)
+
+// version2c is the value of the version field of an SNMPv2c message.
+const version2c = 1
+
+// tlv encodes a BER type-length-value element.
+func tlv(tag byte, content []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(tag)
+	if n := len(content); n < 0x80 {
+		buf.WriteByte(byte(n))
+	} else {
+		var length []byte
+		for ; n > 0; n >>= 8 {
+			length = append([]byte{byte(n)}, length...)
+		}
+		buf.WriteByte(0x80 | byte(len(length)))
+		buf.Write(length)
+	}
+	buf.Write(content)
+	return buf.Bytes()
+}
+
+// encodeInteger encodes a signed integer in the minimal number of
+// bytes.
+func encodeInteger(v int64) []byte {
+	content := make([]byte, 8)
+	binary.BigEndian.PutUint64(content, uint64(v))
+	for len(content) > 1 &&
+		((content[0] == 0 && content[1]&0x80 == 0) || (content[0] == 0xff && content[1]&0x80 != 0)) {
+		content = content[1:]
+	}
+	return tlv(tagInteger, content)
+}
+
+// encodeOID encodes an object identifier in dotted notation like
+// "1.3.6.1.2.1.1.3.0". A leading dot is allowed.
+func encodeOID(oid string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", oid)
+	}
+	arcs := make([]uint64, len(parts))
+	for i, part := range parts {
+		arc, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q: %w", oid, err)
+		}
+		arcs[i] = arc
+	}
+	if arcs[0] > 2 || (arcs[0] < 2 && arcs[1] > 39) {
+		return nil, fmt.Errorf("invalid OID %q", oid)
+	}
+	var content []byte
+	for _, arc := range append([]uint64{arcs[0]*40 + arcs[1]}, arcs[2:]...) {
+		encoded := []byte{byte(arc & 0x7f)}
+		for arc >>= 7; arc > 0; arc >>= 7 {
+			encoded = append([]byte{byte(arc&0x7f) | 0x80}, encoded...)
+		}
+		content = append(content, encoded...)
+	}
+	return tlv(tagOID, content), nil
+}
+
+// getRequest encodes an SNMPv2c GetRequest message for a single OID.
+func getRequest(community, oid string, requestID int32) ([]byte, error) {
+	encodedOID, err := encodeOID(oid)
+	if err != nil {
+		return nil, err
+	}
+	varbind := tlv(tagSequence, append(encodedOID, tlv(tagNull, nil)...))
+	var pdu []byte
+	pdu = append(pdu, encodeInteger(int64(requestID))...)
+	pdu = append(pdu, encodeInteger(0)...) // error-status
+	pdu = append(pdu, encodeInteger(0)...) // error-index
+	pdu = append(pdu, tlv(tagSequence, varbind)...)
+	var message []byte
+	message = append(message, encodeInteger(version2c)...)
+	message = append(message, tlv(tagOctetString, []byte(community))...)
+	message = append(message, tlv(tagGetRequest, pdu)...)
+	return tlv(tagSequence, message), nil
+}
+
+// element is a decoded BER element.
+type element struct {
+	tag     byte
+	content []byte
+}
+
+// next decodes the first element of data and returns it together with
+// the remaining data.
+func next(data []byte) (element, []byte, error) {
+	if len(data) < 2 {
+		return element{}, nil, errors.New("truncated SNMP message")
+	}
+	tag, length, data := data[0], int(data[1]), data[2:]
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 || len(data) < n {
+			return element{}, nil, errors.New("invalid length in SNMP message")
+		}
+		length = 0
+		for _, b := range data[:n] {
+			length = length<<8 | int(b)
+		}
+		data = data[n:]
+	}
+	if length < 0 || length > len(data) {
+		return element{}, nil, errors.New("truncated SNMP message")
+	}
+	return element{tag: tag, content: data[:length]}, data[length:], nil
+}
+
+// expect decodes the first element of data and checks its tag.
+func expect(data []byte, tag byte) (element, []byte, error) {
+	e, rest, err := next(data)
+	if err != nil {
+		return e, rest, err
+	}
+	if e.tag != tag {
+		return e, rest, fmt.Errorf("unexpected element 0x%02x in SNMP message", e.tag)
+	}
+	return e, rest, nil
+}
+
+// decodeInteger decodes the content of an INTEGER element.
+func decodeInteger(content []byte) (int64, error) {
+	if len(content) == 0 || len(content) > 8 {
+		return 0, errors.New("invalid integer in SNMP message")
+	}
+	v := int64(int8(content[0]))
+	for _, b := range content[1:] {
+		v = v<<8 | int64(b)
+	}
+	return v, nil
+}
+
+// decodeUnsigned decodes the content of an unsigned application type
+// like Counter32, Gauge32 or Counter64.
+func decodeUnsigned(content []byte) (uint64, error) {
+	if len(content) == 0 || len(content) > 9 {
+		return 0, errors.New("invalid unsigned integer in SNMP message")
+	}
+	var v uint64
+	for _, b := range content {
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+// decodeOID decodes the content of an OBJECT IDENTIFIER element into
+// dotted notation.
+func decodeOID(content []byte) (string, error) {
+	var arcs []string
+	var arc uint64
+	for i, b := range content {
+		arc = arc<<7 | uint64(b&0x7f)
+		if b&0x80 != 0 {
+			if i == len(content)-1 {
+				return "", errors.New("invalid OID in SNMP message")
+			}
+			continue
+		}
+		if len(arcs) == 0 {
+			first := arc / 40
+			if first > 2 {
+				first = 2
+			}
+			arcs = append(arcs, strconv.FormatUint(first, 10), strconv.FormatUint(arc-first*40, 10))
+		} else {
+			arcs = append(arcs, strconv.FormatUint(arc, 10))
+		}
+		arc = 0
+	}
+	return strings.Join(arcs, "."), nil
+}
+
+// formatValue converts the value of a variable binding into the text
+// reported to Grid Engine.
+func formatValue(e element) (string, error) {
+	switch e.tag {
+	case tagInteger:
+		v, err := decodeInteger(e.content)
+		return strconv.FormatInt(v, 10), err
+	case tagCounter32, tagGauge32, tagTimeTicks, tagCounter64:
+		v, err := decodeUnsigned(e.content)
+		return strconv.FormatUint(v, 10), err
+	case tagOctetString:
+		return strings.TrimSpace(string(e.content)), nil
+	case tagIPAddress:
+		if len(e.content) != 4 {
+			return "", errors.New("invalid IP address in SNMP message")
+		}
+		return net.IP(e.content).String(), nil
+	case tagOID:
+		return decodeOID(e.content)
+	case tagNoSuchObject, tagNoSuchInstance, tagEndOfMibView:
+		return "", errors.New("no such object")
+	case tagNull:
+		return "", errors.New("agent returned no value")
+	}
+	return "", fmt.Errorf("unsupported value type 0x%02x", e.tag)
+}
+
+// parseResponse extracts the value of the single variable binding of
+// an SNMPv2c Response message.
+func parseResponse(data []byte, requestID int32) (string, error) {
+	message, _, err := expect(data, tagSequence)
+	if err != nil {
+		return "", err
+	}
+	_, rest, err := expect(message.content, tagInteger) // version
+	if err != nil {
+		return "", err
+	}
+	if _, rest, err = expect(rest, tagOctetString); err != nil { // community
+		return "", err
+	}
+	pdu, _, err := expect(rest, tagResponse)
+	if err != nil {
+		return "", err
+	}
+	var fields [3]int64
+	rest = pdu.content
+	for i := range fields {
+		var e element
+		if e, rest, err = expect(rest, tagInteger); err != nil {
+			return "", err
+		}
+		if fields[i], err = decodeInteger(e.content); err != nil {
+			return "", err
+		}
+	}
+	if fields[0] != int64(requestID) {
+		return "", errors.New("response does not match the request")
+	}
+	if fields[1] != 0 {
+		return "", fmt.Errorf("agent returned error status %d", fields[1])
+	}
+	varbinds, _, err := expect(rest, tagSequence)
+	if err != nil {
+		return "", err
+	}
+	varbind, _, err := expect(varbinds.content, tagSequence)
+	if err != nil {
+		return "", err
+	}
+	_, rest, err = expect(varbind.content, tagOID)
+	if err != nil {
+		return "", err
+	}
+	value, _, err := next(rest)
+	if err != nil {
+		return "", err
+	}
+	return formatValue(value)
+}
+
+// Get requests the value of a single OID from the SNMPv2c agent at
+// target (host or host:port, the default port is 161) using the given
+// community. Numeric values are returned as decimal numbers, octet
+// strings as text. An error is returned when the agent does not answer
+// within Timeout, rejects the request or does not know the OID.
+func Get(target, oid, community string) (string, error) {
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(target, "161")
+	}
+	var id [4]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", err
+	}
+	requestID := int32(binary.BigEndian.Uint32(id[:]) & 0x7fffffff)
+	request, err := getRequest(community, oid, requestID)
+	if err != nil {
+		return "", err
+	}
+	conn, err := net.DialTimeout("udp", target, Timeout)
+	if err != nil {
+		return "", fmt.Errorf("SNMP agent %s: %w", target, err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(Timeout)); err != nil {
+		return "", err
+	}
+	if _, err := conn.Write(request); err != nil {
+		return "", fmt.Errorf("SNMP agent %s: %w", target, err)
+	}
+	response := make([]byte, 65536)
+	n, err := conn.Read(response)
+	if err != nil {
+		return "", fmt.Errorf("SNMP agent %s: %w", target, err)
+	}
+	value, err := parseResponse(response[:n], requestID)
+	if err != nil {
+		return "", fmt.Errorf("SNMP agent %s, OID %s: %w", target, oid, err)
+	}
+	return value, nil
+}
+
+// NewSensor creates a sensor for the local host which reports the
+// value of the given OID polled from the SNMPv2c agent at target as
+// resource (see Get). When the agent is unreachable the measurement
+// fails and the value is omitted from the load report.
+func NewSensor(resource, target, oid, community string) loadsensor.Sensor {
+	return loadsensor.NewSensor(resource, func() (string, error) {
+		return Get(target, oid, community)
+	})
+}
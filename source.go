@@ -0,0 +1,210 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// cycleKey is the context key under which the current cycle is
+// stored in the context passed to a MeasurementContextFunction.
+type cycleKey struct{}
+
+// cycleInfo identifies one load report of a context. Its address is
+// unique for each report.
+type cycleInfo struct {
+	number uint64
+	start  time.Time
+	// prefixes are the resource prefixes of the sensors which are
+	// removed from the resource names of ReportedValue
+	prefixes []string
+
+	mutex sync.Mutex
+	memo  map[string]*memoEntry
+	// values and finished track the sensors of the cycle which are
+	// finished for ReportedValue
+	values   map[string]string
+	finished []chan struct{}
+	// store is the CycleStore of the cycle
+	store *CycleStore
+}
+
+// memoEntry is the memoized result of a function within one cycle.
+type memoEntry struct {
+	once  sync.Once
+	value interface{}
+	err   error
+}
+
+// memoize executes f at most once per load report for each key and
+// returns its (shared) result. The cache only lives for a single load
+// report: the next report executes f again (use a TTL cache to keep
+// results across load reports). Outside of a load report f is
+// executed on each call.
+func memoize[T any](c context.Context, key string, f func() (T, error)) (T, error) {
+	cycle := currentCycle(c)
+	if cycle == nil {
+		return f()
+	}
+	cycle.mutex.Lock()
+	if cycle.memo == nil {
+		cycle.memo = make(map[string]*memoEntry)
+	}
+	entry, found := cycle.memo[key]
+	if !found {
+		entry = &memoEntry{}
+		cycle.memo[key] = entry
+	}
+	cycle.mutex.Unlock()
+	entry.once.Do(func() {
+		entry.value, entry.err = f()
+	})
+	value, _ := entry.value.(T)
+	return value, entry.err
+}
+
+// currentCycle returns the cycle the given context belongs to or nil
+// when the context was not created by a load report.
+func currentCycle(c context.Context) *cycleInfo {
+	if c == nil {
+		return nil
+	}
+	info, _ := c.Value(cycleKey{}).(*cycleInfo)
+	return info
+}
+
+// CycleStore holds intermediate results which cooperating sensors
+// share within one load report, like a parsed /proc file used by
+// several sensors. A new empty store is created for each load report
+// and dropped afterwards. With WithBackgroundMeasurement each
+// measurement of a sensor has its own store. A CycleStore is safe for
+// concurrent use by sensors measured in parallel, but values stored
+// in it must be safe for concurrent use as well or must not be
+// modified after they were stored.
+type CycleStore struct {
+	mutex  sync.Mutex
+	values map[string]interface{}
+}
+
+// CycleStoreFrom returns the CycleStore of the load report the given
+// context belongs to. Outside of a load report a new empty store is
+// returned on each call.
+func CycleStoreFrom(c context.Context) *CycleStore {
+	cycle := currentCycle(c)
+	if cycle == nil {
+		return &CycleStore{}
+	}
+	cycle.mutex.Lock()
+	defer cycle.mutex.Unlock()
+	if cycle.store == nil {
+		cycle.store = &CycleStore{}
+	}
+	return cycle.store
+}
+
+// Get returns the value stored under key.
+func (s *CycleStore) Get(key string) (interface{}, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	value, found := s.values[key]
+	return value, found
+}
+
+// Set stores value under key, replacing a previous value.
+func (s *CycleStore) Set(key string, value interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.values == nil {
+		s.values = make(map[string]interface{})
+	}
+	s.values[key] = value
+}
+
+// CycleValue returns the value of type T stored under key in the
+// CycleStore of the current load report. When there is none, compute
+// is called and its result is stored unless it fails. Sensors measured
+// in parallel may call compute concurrently for the same key, the last
+// result is kept then. Use a Source when the computation must happen
+// exactly once per load report.
+func CycleValue[T any](c context.Context, key string, compute func() (T, error)) (T, error) {
+	store := CycleStoreFrom(c)
+	if value, found := store.Get(key); found {
+		if v, ok := value.(T); ok {
+			return v, nil
+		}
+	}
+	v, err := compute()
+	if err != nil {
+		return v, err
+	}
+	store.Set(key, v)
+	return v, nil
+}
+
+// Source is an expensive measurement (like parsing the output of
+// nvidia-smi) whose result is used by several sensors. The source
+// function is executed at most once per load report, even when the
+// sensors using it are measured in parallel. Each sensor derives its
+// own value from the shared result.
+type Source[T any] struct {
+	mutex sync.Mutex
+	f     func(context.Context) (T, error)
+	cycle *cycleInfo
+	value T
+	err   error
+}
+
+// NewSource creates a Source which uses f to perform the shared
+// measurement.
+func NewSource[T any](f func(context.Context) (T, error)) *Source[T] {
+	return &Source[T]{f: f}
+}
+
+// Get returns the result of the source for the load report the given
+// context belongs to, executing the source function when this is the
+// first call in the report. When called outside of a load report the
+// source function is executed on each call.
+func (s *Source[T]) Get(c context.Context) (T, error) {
+	cycle := currentCycle(c)
+	if cycle == nil {
+		return s.f(c)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.cycle != cycle {
+		s.value, s.err = s.f(c)
+		s.cycle = cycle
+	}
+	return s.value, s.err
+}
+
+// Sensor creates a sensor for the local host which reports the value
+// derive computes from the result of the source as resource. When the
+// source fails the error is returned for all sensors using it.
+func (s *Source[T]) Sensor(resource string, derive func(T) (string, error)) Sensor {
+	sensor := NewSensor(resource, nil)
+	sensor.MeasurementContextFunction = func(c context.Context) (string, error) {
+		v, err := s.Get(c)
+		if err != nil {
+			return "", err
+		}
+		return derive(v)
+	}
+	return sensor
+}
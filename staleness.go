@@ -0,0 +1,67 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import "time"
+
+// WithStaleThreshold sets the age above which a value is marked as
+// stale in its Report (see Report.Stale). The age of a value is the
+// time between its measurement and the start of the load report, so
+// it is only above zero for values which were not measured in the
+// load report: values of a cache (like NewLicenseSensor), of a sensor
+// with an Interval and of background measurements (see
+// WithBackgroundMeasurement), which keep their last value when they
+// fail. The default of 0 marks all of these values as stale, a
+// threshold above the cache TTL or the Interval only marks values
+// which are older than expected. The threshold only affects the
+// Status and the report sinks, use WithMaxValueAge to keep stale
+// values away from Grid Engine.
+func WithStaleThreshold(d time.Duration) Option {
+	return func(ctx *Context) {
+		if d < 0 {
+			d = 0
+		}
+		ctx.staleThreshold = d
+	}
+}
+
+// WithMaxValueAge drops values which are older than d (see
+// WithStaleThreshold) from the load report, so that Grid Engine does
+// not schedule on outdated data. Grid Engine then keeps the previously
+// reported value until it expires. d must be larger than the cache TTL
+// and the Interval of all sensors, otherwise their values are dropped
+// in the load reports between two measurements. The default of 0
+// reports values of any age.
+func WithMaxValueAge(d time.Duration) Option {
+	return func(ctx *Context) {
+		ctx.maxValueAge = d
+	}
+}
+
+// annotateAge sets the age of a value reported in the load report
+// which started at start. It returns false when the value is too old
+// to be reported.
+func (ctx *Context) annotateAge(r *Report, start time.Time) bool {
+	if r.MeasuredAt.IsZero() {
+		return true
+	}
+	if age := start.Sub(r.MeasuredAt); age > 0 {
+		r.Age = age
+	}
+	r.Stale = r.Age > ctx.staleThreshold
+	return ctx.maxValueAge <= 0 || r.Age <= ctx.maxValueAge
+}
@@ -0,0 +1,117 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// ErrStateReset is returned by LoadState when a state file exists but
+// can not be used, so that the caller starts with a fresh state.
+var ErrStateReset = errors.New("persisted state is reset")
+
+// stateFile is the format of the state files written by SaveState:
+//
+//	{"version": 2, "data": {...}}
+//
+// data is the JSON encoding of the state in the given version.
+type stateFile struct {
+	Version int             `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// StateMigration converts the data of a state file from one version
+// to the next one. For version 0 the data is the raw content of a
+// file which was written before it used the state file format, which
+// can also be a JSON object without version and data.
+type StateMigration func(data []byte) ([]byte, error)
+
+// SaveState writes v as JSON with the given version to the state file
+// at path (see LoadState). The file is replaced atomically, so that a
+// crash while writing keeps the previous state.
+func SaveState(path string, version int, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(stateFile{Version: version, Data: data})
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(content, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadState reads the state file at path written by SaveState into v,
+// which must be a pointer. The returned bool is false when there is
+// no state file. State which survives an upgrade of the load sensor
+// follows these rules:
+//
+//   - Fields which are added to or removed from the state keep the
+//     version: unknown fields are ignored when loading and missing
+//     fields keep the value v has, so the format is forward compatible.
+//   - A change of the meaning of fields increments the version and
+//     adds a StateMigration: migrations[n] converts version n to n+1.
+//     Older state files are migrated step by step to version.
+//   - A file which can not be parsed, which has a newer version than
+//     version (after a downgrade) or a version without migration is
+//     not used. The returned error wraps ErrStateReset and v is
+//     unchanged, the caller continues with its initial state.
+func LoadState(path string, version int, migrations map[int]StateMigration, v interface{}) (bool, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrStateReset, err)
+	}
+	var state stateFile
+	if !bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")) {
+		state = stateFile{Version: 0, Data: content}
+	} else if err := json.Unmarshal(content, &state); err != nil {
+		return false, fmt.Errorf("%w: invalid state file %s: %w", ErrStateReset, path, err)
+	} else if state.Data == nil {
+		// a JSON object written before the state file format
+		state = stateFile{Version: 0, Data: content}
+	}
+	if state.Version > version {
+		return false, fmt.Errorf("%w: state file %s has the unknown version %d", ErrStateReset, path, state.Version)
+	}
+	data := []byte(state.Data)
+	for n := state.Version; n < version; n++ {
+		migrate, found := migrations[n]
+		if !found {
+			return false, fmt.Errorf("%w: no migration of state file %s from version %d", ErrStateReset, path, n)
+		}
+		if data, err = migrate(data); err != nil {
+			return false, fmt.Errorf("%w: migration of state file %s from version %d failed: %w",
+				ErrStateReset, path, n, err)
+		}
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("%w: invalid state in %s: %w", ErrStateReset, path, err)
+	}
+	return true, nil
+}
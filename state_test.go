@@ -0,0 +1,143 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testState is version 2 of a state: version 1 stored the restarts
+// as "count", version 0 was a plain number.
+type testState struct {
+	Restarts int    `json:"restarts"`
+	Host     string `json:"host"`
+}
+
+var testMigrations = map[int]StateMigration{
+	0: func(data []byte) ([]byte, error) {
+		return []byte(`{"count": ` + strings.TrimSpace(string(data)) + `}`), nil
+	},
+	1: func(data []byte) ([]byte, error) {
+		var v1 struct {
+			Count int `json:"count"`
+		}
+		if err := json.Unmarshal(data, &v1); err != nil {
+			return nil, err
+		}
+		return json.Marshal(testState{Restarts: v1.Count})
+	},
+}
+
+func TestLoadStateMigrations(t *testing.T) {
+	tests := []struct {
+		content  string
+		restarts int
+	}{
+		{`{"version": 2, "data": {"restarts": 7, "host": "node1", "removed": true}}`, 7},
+		{`{"version": 1, "data": {"count": 5}}`, 5},
+		{"3\n", 3},
+	}
+	for i, test := range tests {
+		path := filepath.Join(t.TempDir(), "state.json")
+		if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		state := testState{Host: "initial"}
+		found, err := LoadState(path, 2, testMigrations, &state)
+		if err != nil || !found {
+			t.Errorf("test %d: got %v, %v", i, found, err)
+			continue
+		}
+		if state.Restarts != test.restarts {
+			t.Errorf("test %d: expected %d restarts, got %d", i, test.restarts, state.Restarts)
+		}
+	}
+}
+
+func TestLoadStateUnversionedObject(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(`{"restarts": 4}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var migrated string
+	migrations := map[int]StateMigration{0: func(data []byte) ([]byte, error) {
+		migrated = string(data)
+		return data, nil
+	}}
+	var state testState
+	if found, err := LoadState(path, 1, migrations, &state); err != nil || !found {
+		t.Fatalf("got %v, %v", found, err)
+	}
+	if migrated != `{"restarts": 4}` || state.Restarts != 4 {
+		t.Errorf("the file was migrated from %q to %+v", migrated, state)
+	}
+}
+
+func TestLoadStateReset(t *testing.T) {
+	failing := map[int]StateMigration{
+		0: testMigrations[0],
+		1: func([]byte) ([]byte, error) { return nil, errors.New("broken") },
+	}
+	tests := []struct {
+		content    string
+		migrations map[int]StateMigration
+	}{
+		{`{"version": 2, "data": {"restarts": 7`, testMigrations},
+		{`{"version": 2, "data": {"restarts": "seven"}}`, testMigrations},
+		{`{"version": 3, "data": {"restarts": 7}}`, testMigrations},
+		{`{"version": 1, "data": {"count": 5}}`, map[int]StateMigration{0: testMigrations[0]}},
+		{`{"version": 1, "data": {"count": 5}}`, failing},
+		{"not a number", testMigrations},
+	}
+	for i, test := range tests {
+		path := filepath.Join(t.TempDir(), "state.json")
+		if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		state := testState{Restarts: 1}
+		found, err := LoadState(path, 2, test.migrations, &state)
+		if found || !errors.Is(err, ErrStateReset) {
+			t.Errorf("test %d: expected ErrStateReset, got %v, %v", i, found, err)
+		}
+		if state.Restarts != 1 {
+			t.Errorf("test %d: the state was changed to %+v", i, state)
+		}
+	}
+	found, err := LoadState(filepath.Join(t.TempDir(), "missing.json"), 2, testMigrations, &testState{})
+	if found || err != nil {
+		t.Errorf("missing state file: got %v, %v", found, err)
+	}
+}
+
+func TestSaveStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := SaveState(path, 2, testState{Restarts: 9, Host: "node1"}); err != nil {
+		t.Fatal(err)
+	}
+	var state testState
+	if found, err := LoadState(path, 2, testMigrations, &state); err != nil || !found {
+		t.Fatalf("got %v, %v", found, err)
+	}
+	if state != (testState{Restarts: 9, Host: "node1"}) {
+		t.Errorf("unexpected state %+v", state)
+	}
+}
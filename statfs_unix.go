@@ -0,0 +1,38 @@
+//go:build linux || darwin
+
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// statfs returns the usage of the file system containing path.
+func statfs(path string) (fsUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return fsUsage{}, fmt.Errorf("statfs %s: %w", path, err)
+	}
+	return fsUsage{
+		bytesTotal:  uint64(st.Blocks) * uint64(st.Bsize),
+		bytesFree:   uint64(st.Bavail) * uint64(st.Bsize),
+		inodesTotal: uint64(st.Files),
+		inodesFree:  uint64(st.Ffree),
+	}, nil
+}
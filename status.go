@@ -0,0 +1,248 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Report is one value reported to Grid Engine.
+type Report struct {
+	Host     string `json:"host"`
+	Resource string `json:"resource"`
+	Value    string `json:"value"`
+	// MeasuredAt is the time the value was measured. For values
+	// served from a cache (like the one of NewLicenseSensor) this is
+	// the time of the original measurement.
+	MeasuredAt time.Time `json:"measured_at"`
+	// Age is the time between MeasuredAt and the start of the load
+	// report. It is zero for values measured during the load report.
+	// Stale is true when the Age is above the stale threshold (see
+	// WithStaleThreshold).
+	Age   time.Duration `json:"age,omitempty"`
+	Stale bool          `json:"stale,omitempty"`
+	// Shadow is true for values of a shadow sensor (see Sensor.Shadow)
+	// which were not written to Grid Engine.
+	Shadow bool `json:"shadow,omitempty"`
+	// Labels of the sensor which reported the value (see
+	// Sensor.Labels). They are never part of the load report.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// SensorStatus contains the state of one sensor of a context.
+type SensorStatus struct {
+	// Host and Resource of the last successful or failed measurement
+	// as far as they could be determined.
+	Host     string `json:"host,omitempty"`
+	Resource string `json:"resource,omitempty"`
+	// Unit and Type are the metadata of the sensor (see Sensor.Unit).
+	Unit string `json:"unit,omitempty"`
+	Type string `json:"type,omitempty"`
+	// Labels are the labels of the sensor (see Sensor.Labels).
+	Labels map[string]string `json:"labels,omitempty"`
+	// Value is the last successfully measured value and MeasuredAt the
+	// time it was measured (see Report.MeasuredAt).
+	Value      string    `json:"value,omitempty"`
+	MeasuredAt time.Time `json:"measured_at"`
+	// LastError is the error of the last measurement when it failed.
+	LastError string `json:"last_error,omitempty"`
+	// Measurements counts how often the sensor was executed.
+	Measurements uint64 `json:"measurements"`
+	// Failures counts how often the sensor failed since the start.
+	Failures uint64 `json:"failures"`
+	// ConsecutiveFailures counts the failures since the last success.
+	ConsecutiveFailures uint64 `json:"consecutive_failures"`
+	// CircuitOpen is true while the CircuitBreaker of the sensor is
+	// open, from the failure which opened it until the next successful
+	// measurement.
+	CircuitOpen bool `json:"circuit_open,omitempty"`
+}
+
+// StatusSchemaVersion is the version of the JSON encoding of Status,
+// which is served by the status package and written by embedding
+// programs. Consumers should check it before parsing the document. It
+// is incremented whenever a field is removed or renamed or changes its
+// type or meaning. Added fields do not change the version, so
+// consumers must ignore fields they do not know.
+const StatusSchemaVersion = 1
+
+// Status contains the state of a context which is running the load
+// sensor protocol.
+type Status struct {
+	// SchemaVersion is the StatusSchemaVersion of the JSON encoding.
+	SchemaVersion int `json:"schema_version"`
+	// Started is the time the context was created and Uptime the time
+	// since then (in nanoseconds in JSON).
+	Started time.Time     `json:"started"`
+	Uptime  time.Duration `json:"uptime"`
+	// Cycles is the number of load reports written since the start.
+	Cycles uint64 `json:"cycles"`
+	// LastCycle is the time the last load report was written.
+	LastCycle time.Time `json:"last_cycle"`
+	// Ready is true when the last load report was written within the
+	// readiness window (see Ready).
+	Ready bool `json:"ready"`
+	// Paused is true while the context is paused (see Pause).
+	Paused bool `json:"paused,omitempty"`
+	// HookDrops is the number of load reports dropped since the queue
+	// of an async report hook was full (see WithAsyncReportHook).
+	HookDrops uint64 `json:"hook_drops,omitempty"`
+	// LastReport contains the values of the last load report,
+	// including the values of shadow sensors (see Sensor.Shadow).
+	LastReport []Report `json:"last_report"`
+	// Sensors contains the state of each sensor in sensor order.
+	Sensors []SensorStatus `json:"sensors"`
+}
+
+// record updates the state of the context after a cycle. written is
+// false when the load report could not be written.
+func (ctx *Context) record(results []measurement, report []Report, written bool) {
+	var renamed []string
+	defer func() {
+		for _, warning := range renamed {
+			ctx.logf("%s", warning)
+		}
+	}()
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	ctx.cycles++
+	if written {
+		ctx.lastCycle = ctx.clock.Now()
+		ctx.lastReport = report
+	}
+	for i, m := range results {
+		if !m.ran {
+			continue
+		}
+		stats := &ctx.stats[i]
+		if m.reused {
+			continue
+		}
+		stats.Measurements++
+		if m.host != "" {
+			stats.Host = m.host
+		}
+		if m.resource != "" {
+			if stats.Resource != "" && stats.Resource != m.resource {
+				renamed = append(renamed, fmt.Sprintf("warning: resource name of sensor %d changed from %q to %q, "+
+					"resource names are expected to be stable", i, stats.Resource, m.resource))
+			}
+			stats.Resource = m.resource
+		}
+		stats.CircuitOpen = errors.Is(m.err, ErrCircuitOpen)
+		if m.err != nil {
+			stats.LastError = m.err.Error()
+			stats.Failures++
+			stats.ConsecutiveFailures++
+			continue
+		}
+		if !m.skipped || m.cleared {
+			stats.Value, stats.MeasuredAt = m.value, m.measuredAt
+		}
+		stats.LastError = ""
+		stats.ConsecutiveFailures = 0
+	}
+}
+
+// Status returns a deep copy of the current state of the context, so
+// the caller can keep and modify it without affecting the context. It
+// can be called concurrently to Run and is the single accessor behind
+// the status handler, dashboards of embedding programs and tests.
+func (ctx *Context) Status() Status {
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	status := Status{
+		SchemaVersion: StatusSchemaVersion,
+		Started:       ctx.started,
+		Uptime:        ctx.clock.Now().Sub(ctx.started),
+		Cycles:        ctx.cycles,
+		LastCycle:     ctx.lastCycle,
+		Ready:         ctx.ready(),
+		Paused:        ctx.paused,
+		HookDrops:     ctx.hookDrops,
+		LastReport:    append([]Report(nil), ctx.lastReport...),
+		Sensors:       append([]SensorStatus(nil), ctx.stats...),
+	}
+	for i := range status.LastReport {
+		status.LastReport[i].Labels = copyLabels(status.LastReport[i].Labels)
+	}
+	for i := range status.Sensors {
+		status.Sensors[i].Labels = copyLabels(status.Sensors[i].Labels)
+	}
+	return status
+}
+
+// Snapshot returns the same deep copy of the state as Status. It is
+// provided for embedding programs which poll the state of a context.
+func (ctx *Context) Snapshot() Status {
+	return ctx.Status()
+}
+
+// copyLabels returns a copy of the given labels.
+func copyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+	c := make(map[string]string, len(labels))
+	for k, v := range labels {
+		c[k] = v
+	}
+	return c
+}
+
+// DefaultReadinessWindow is the time since the last successful load
+// report after which a context is not considered ready anymore. It
+// covers three default Grid Engine load report intervals of 40s.
+const DefaultReadinessWindow = 2 * time.Minute
+
+// WithReadinessWindow sets the time since the last successful load
+// report within which Ready returns true. The default is
+// DefaultReadinessWindow. It should be larger than the load report
+// interval of the execd.
+func WithReadinessWindow(d time.Duration) Option {
+	return func(ctx *Context) {
+		ctx.readinessWindow = d
+	}
+}
+
+// ready must be called with the mutex held.
+func (ctx *Context) ready() bool {
+	if ctx.lastCycle.IsZero() {
+		return false
+	}
+	return ctx.clock.Now().Sub(ctx.lastCycle) <= ctx.readinessWindow
+}
+
+// Ready returns true when the context completed a load report within
+// the readiness window (see WithReadinessWindow). It is false before
+// the first load report and when the load sensor is stuck, for example
+// in a hanging measurement, so that it can be used for health probes.
+func (ctx *Context) Ready() bool {
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	return ctx.ready()
+}
+
+// LastCycleTime returns the time the last load report was
+// successfully written or the zero time when there was none.
+func (ctx *Context) LastCycleTime() time.Time {
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	return ctx.lastCycle
+}
@@ -0,0 +1,72 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package status provides an HTTP handler which serves the state of
+// a running load sensor as JSON. It is a separate package so that
+// load sensors which do not need it are not linked against net/http.
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dgruber/loadsensor"
+)
+
+// Handler returns an http.Handler which serves the Status of the
+// given load sensor context as JSON document. It can be mounted by
+// programs already running an HTTP server, for example at
+// /sensor/status. The schema_version field of the document tells the
+// version of its format (see loadsensor.StatusSchemaVersion).
+func Handler(ctx *loadsensor.Context) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowed(w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(ctx.Status()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// ReadyHandler returns an http.Handler for readiness or liveness
+// probes. It responds with 200 OK when the context is Ready and with
+// 503 Service Unavailable otherwise. Like Handler it only answers GET
+// and HEAD requests.
+func ReadyHandler(ctx *loadsensor.Context) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowed(w, r) {
+			return
+		}
+		if !ctx.Ready() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+}
+
+// allowed responds with 405 Method Not Allowed and returns false for
+// requests other than GET and HEAD.
+func allowed(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+	w.Header().Set("Allow", "GET, HEAD")
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
@@ -0,0 +1,50 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package status
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgruber/loadsensor"
+)
+
+func TestReadyHandlerMethods(t *testing.T) {
+	ctx, err := loadsensor.Create([]loadsensor.Sensor{
+		loadsensor.NewSensor("value", func() (string, error) { return "1", nil }),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := ReadyHandler(ctx)
+	for method, code := range map[string]int{
+		http.MethodGet:    http.StatusServiceUnavailable,
+		http.MethodHead:   http.StatusServiceUnavailable,
+		http.MethodPost:   http.StatusMethodNotAllowed,
+		http.MethodDelete: http.StatusMethodNotAllowed,
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, "/ready", nil))
+		if w.Code != code {
+			t.Errorf("%s: expected status %d, got %d", method, code, w.Code)
+		}
+		if code == http.StatusMethodNotAllowed && w.Header().Get("Allow") != "GET, HEAD" {
+			t.Errorf("%s: unexpected Allow header %q", method, w.Header().Get("Allow"))
+		}
+	}
+}
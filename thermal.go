@@ -0,0 +1,81 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// thermalZones is the glob matching the temperature files of all
+// thermal zones exposed by the kernel.
+const thermalZones = "/sys/class/thermal/thermal_zone*/temp"
+
+// TemperatureMeasurement reports the temperature of the hottest
+// thermal zone of the host in degrees Celsius (the kernel exposes
+// millidegrees which are converted). An error is returned when the
+// host does not expose any thermal zone instead of reporting a fake
+// value. It is only supported on Linux.
+func TemperatureMeasurement() (string, error) {
+	if err := requireLinux(); err != nil {
+		return "", err
+	}
+	zones, err := filepath.Glob(thermalZones)
+	if err != nil {
+		return "", err
+	}
+	if len(zones) == 0 {
+		return "", errors.New("no thermal zones found in /sys/class/thermal")
+	}
+	found := false
+	var hottest int64
+	var lastErr error
+	for _, zone := range zones {
+		content, err := os.ReadFile(zone)
+		if err != nil {
+			if os.IsPermission(err) {
+				lastErr = fmt.Errorf("no permission to read temperature %s: %w", zone, err)
+			} else {
+				lastErr = fmt.Errorf("can not read temperature %s: %w", zone, err)
+			}
+			continue
+		}
+		milliCelsius, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+		if err != nil {
+			lastErr = fmt.Errorf("invalid temperature in %s: %w", zone, err)
+			continue
+		}
+		if !found || milliCelsius > hottest {
+			hottest = milliCelsius
+			found = true
+		}
+	}
+	if !found {
+		return "", lastErr
+	}
+	return formatFloat(float64(hottest) / 1000), nil
+}
+
+// NewTemperatureSensor creates a sensor reporting the temperature of
+// the hottest thermal zone in degrees Celsius as resource.
+func NewTemperatureSensor(resource string) Sensor {
+	return NewSensor(resource, TemperatureMeasurement)
+}
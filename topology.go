@@ -0,0 +1,124 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// cpuTopology contains the number of logical processors, physical
+// cores and sockets found in /proc/cpuinfo.
+type cpuTopology struct {
+	processors int
+	cores      int
+	sockets    int
+}
+
+// parseCPUInfo parses the content of /proc/cpuinfo. When the
+// "physical id" and "core id" fields are not available (like on
+// some ARM systems) each processor is counted as a core on a
+// single socket.
+func parseCPUInfo(cpuinfo []byte) (cpuTopology, error) {
+	var topology cpuTopology
+	sockets := make(map[string]bool)
+	cores := make(map[string]bool)
+	physicalID := ""
+	scanner := bufio.NewScanner(bytes.NewReader(cpuinfo))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "processor":
+			topology.processors++
+			physicalID = ""
+		case "physical id":
+			physicalID = value
+			sockets[value] = true
+		case "core id":
+			cores[physicalID+"/"+value] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return topology, err
+	}
+	if topology.processors == 0 {
+		return topology, errors.New("no processors found in /proc/cpuinfo")
+	}
+	topology.cores, topology.sockets = len(cores), len(sockets)
+	if topology.cores == 0 {
+		topology.cores = topology.processors
+	}
+	if topology.sockets == 0 {
+		topology.sockets = 1
+	}
+	return topology, nil
+}
+
+func readCPUTopology() (cpuTopology, error) {
+	cpuinfo, err := readProcFile("/proc/cpuinfo")
+	if err != nil {
+		return cpuTopology{}, err
+	}
+	return parseCPUInfo(cpuinfo)
+}
+
+// CoreCount returns the number of physical CPU cores of the host
+// as found in /proc/cpuinfo. It is only supported on Linux.
+func CoreCount() (int, error) {
+	topology, err := readCPUTopology()
+	return topology.cores, err
+}
+
+// SocketCount returns the number of CPU sockets of the host as found
+// in /proc/cpuinfo. It is only supported on Linux.
+func SocketCount() (int, error) {
+	topology, err := readCPUTopology()
+	return topology.sockets, err
+}
+
+// intMeasurement converts a function returning an int into a
+// measurement function.
+func intMeasurement(f func() (int, error)) func() (string, error) {
+	return func() (string, error) {
+		v, err := f()
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(v), nil
+	}
+}
+
+// NewCoreCountSensor creates a sensor reporting the number of
+// physical CPU cores as resource. Since the topology does not change
+// while the host is up the value is measured only once.
+func NewCoreCountSensor(resource string) Sensor {
+	return NewStaticSensor(resource, intMeasurement(CoreCount))
+}
+
+// NewSocketCountSensor creates a sensor reporting the number of CPU
+// sockets as resource. Since the topology does not change while the
+// host is up the value is measured only once.
+func NewSocketCountSensor(resource string) Sensor {
+	return NewStaticSensor(resource, intMeasurement(SocketCount))
+}
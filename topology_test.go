@@ -0,0 +1,172 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import "testing"
+
+// cpuinfoXeon is the /proc/cpuinfo of a host with 2 sockets of 2 cores
+// with hyper-threading (shortened to the relevant fields).
+const cpuinfoXeon = `processor	: 0
+vendor_id	: GenuineIntel
+cpu family	: 6
+model name	: Intel(R) Xeon(R) Gold 6130 CPU @ 2.10GHz
+physical id	: 0
+siblings	: 4
+core id		: 0
+cpu cores	: 2
+apicid		: 0
+flags		: fpu vme de pse tsc msr pae mce cx8 apic sep mtrr
+
+processor	: 1
+vendor_id	: GenuineIntel
+cpu family	: 6
+model name	: Intel(R) Xeon(R) Gold 6130 CPU @ 2.10GHz
+physical id	: 0
+siblings	: 4
+core id		: 0
+cpu cores	: 2
+apicid		: 1
+flags		: fpu vme de pse tsc msr pae mce cx8 apic sep mtrr
+
+processor	: 2
+vendor_id	: GenuineIntel
+cpu family	: 6
+model name	: Intel(R) Xeon(R) Gold 6130 CPU @ 2.10GHz
+physical id	: 0
+siblings	: 4
+core id		: 1
+cpu cores	: 2
+apicid		: 2
+flags		: fpu vme de pse tsc msr pae mce cx8 apic sep mtrr
+
+processor	: 3
+vendor_id	: GenuineIntel
+cpu family	: 6
+model name	: Intel(R) Xeon(R) Gold 6130 CPU @ 2.10GHz
+physical id	: 0
+siblings	: 4
+core id		: 1
+cpu cores	: 2
+apicid		: 3
+flags		: fpu vme de pse tsc msr pae mce cx8 apic sep mtrr
+
+processor	: 4
+vendor_id	: GenuineIntel
+cpu family	: 6
+model name	: Intel(R) Xeon(R) Gold 6130 CPU @ 2.10GHz
+physical id	: 1
+siblings	: 4
+core id		: 0
+cpu cores	: 2
+apicid		: 8
+flags		: fpu vme de pse tsc msr pae mce cx8 apic sep mtrr
+
+processor	: 5
+vendor_id	: GenuineIntel
+cpu family	: 6
+model name	: Intel(R) Xeon(R) Gold 6130 CPU @ 2.10GHz
+physical id	: 1
+siblings	: 4
+core id		: 0
+cpu cores	: 2
+apicid		: 9
+flags		: fpu vme de pse tsc msr pae mce cx8 apic sep mtrr
+
+processor	: 6
+vendor_id	: GenuineIntel
+cpu family	: 6
+model name	: Intel(R) Xeon(R) Gold 6130 CPU @ 2.10GHz
+physical id	: 1
+siblings	: 4
+core id		: 1
+cpu cores	: 2
+apicid		: 10
+flags		: fpu vme de pse tsc msr pae mce cx8 apic sep mtrr
+
+processor	: 7
+vendor_id	: GenuineIntel
+cpu family	: 6
+model name	: Intel(R) Xeon(R) Gold 6130 CPU @ 2.10GHz
+physical id	: 1
+siblings	: 4
+core id		: 1
+cpu cores	: 2
+apicid		: 11
+flags		: fpu vme de pse tsc msr pae mce cx8 apic sep mtrr
+`
+
+// cpuinfoARM is the /proc/cpuinfo of an ARM host with 4 cores, which
+// has no physical id and core id fields.
+const cpuinfoARM = `processor	: 0
+BogoMIPS	: 50.00
+Features	: fp asimd evtstrm aes pmull sha1 sha2 crc32 cpuid
+CPU implementer	: 0x41
+CPU architecture: 8
+CPU variant	: 0x3
+CPU part	: 0xd0c
+CPU revision	: 1
+
+processor	: 1
+BogoMIPS	: 50.00
+Features	: fp asimd evtstrm aes pmull sha1 sha2 crc32 cpuid
+CPU implementer	: 0x41
+CPU architecture: 8
+CPU variant	: 0x3
+CPU part	: 0xd0c
+CPU revision	: 1
+
+processor	: 2
+BogoMIPS	: 50.00
+Features	: fp asimd evtstrm aes pmull sha1 sha2 crc32 cpuid
+CPU implementer	: 0x41
+CPU architecture: 8
+CPU variant	: 0x3
+CPU part	: 0xd0c
+CPU revision	: 1
+
+processor	: 3
+BogoMIPS	: 50.00
+Features	: fp asimd evtstrm aes pmull sha1 sha2 crc32 cpuid
+CPU implementer	: 0x41
+CPU architecture: 8
+CPU variant	: 0x3
+CPU part	: 0xd0c
+CPU revision	: 1
+`
+
+func TestParseCPUInfo(t *testing.T) {
+	tests := []struct {
+		cpuinfo  string
+		expected cpuTopology
+	}{
+		{cpuinfoXeon, cpuTopology{processors: 8, cores: 4, sockets: 2}},
+		{cpuinfoARM, cpuTopology{processors: 4, cores: 4, sockets: 1}},
+	}
+	for i, test := range tests {
+		topology, err := parseCPUInfo([]byte(test.cpuinfo))
+		if err != nil {
+			t.Errorf("test %d: %s", i, err)
+			continue
+		}
+		if topology != test.expected {
+			t.Errorf("test %d: expected %+v, got %+v", i, test.expected, topology)
+		}
+	}
+	if _, err := parseCPUInfo([]byte("")); err == nil {
+		t.Error("no error for an empty /proc/cpuinfo")
+	}
+}
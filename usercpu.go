@@ -0,0 +1,136 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// clockTicks is the unit of the CPU times in /proc/PID/stat (USER_HZ),
+// which is 100 on all Linux architectures.
+const clockTicks = 100
+
+// lookupUID returns the numeric user id of a user name. A numeric
+// name which is not a known user is taken as user id.
+func lookupUID(username string) (string, error) {
+	u, err := user.Lookup(username)
+	if err == nil {
+		return u.Uid, nil
+	}
+	if _, errNumber := strconv.ParseUint(username, 10, 32); errNumber == nil {
+		return username, nil
+	}
+	return "", err
+}
+
+// processUID returns the real user id of a process from the Uid line
+// of its status file.
+func processUID(dir string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(dir, "status"))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "Uid:" {
+			return fields[1], nil
+		}
+	}
+	return "", fmt.Errorf("no Uid in %s/status", dir)
+}
+
+// processCPUTicks returns the user and system CPU time of a process in
+// clock ticks from its stat file. The command name in the second field
+// can contain spaces and parentheses, so the fields are counted after
+// its closing parenthesis.
+func processCPUTicks(dir string) (uint64, error) {
+	content, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return 0, err
+	}
+	end := bytes.LastIndexByte(content, ')')
+	if end < 0 {
+		return 0, fmt.Errorf("invalid %s/stat", dir)
+	}
+	// fields after the command name start with the state (field 3),
+	// utime and stime are the fields 14 and 15
+	fields := strings.Fields(string(content[end+1:]))
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("invalid %s/stat", dir)
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return utime + stime, nil
+}
+
+// UserCPUMeasurement returns a measurement function reporting the CPU
+// time in seconds (user and system) consumed by all running processes
+// of the given user, which can be a user name or a numeric user id.
+// Only processes which are running at the time of the measurement are
+// counted, so the value drops when processes of the user exit. This
+// makes it a signal of the current consumption of the user, like for
+// fair-share decisions, rather than an accounting counter. A user
+// without processes reports 0 like ProcessCountMeasurement: an idle
+// user is a valid measurement. An error is returned when the user is
+// unknown or /proc can not be read. Processes which exit during the
+// scan are skipped. It is only supported on Linux.
+func UserCPUMeasurement(username string) func() (string, error) {
+	return func() (string, error) {
+		if err := requireLinux(); err != nil {
+			return "", err
+		}
+		uid, err := lookupUID(username)
+		if err != nil {
+			return "", err
+		}
+		entries, err := os.ReadDir("/proc")
+		if err != nil {
+			return "", err
+		}
+		var ticks uint64
+		for _, entry := range entries {
+			if _, err := strconv.Atoi(entry.Name()); err != nil || !entry.IsDir() {
+				continue
+			}
+			dir := filepath.Join("/proc", entry.Name())
+			if owner, err := processUID(dir); err != nil || owner != uid {
+				continue
+			}
+			if t, err := processCPUTicks(dir); err == nil {
+				ticks += t
+			}
+		}
+		return formatFloat(float64(ticks) / clockTicks), nil
+	}
+}
+
+// NewUserCPUSensor creates a sensor reporting the CPU seconds of the
+// running processes of a user (see UserCPUMeasurement) as resource.
+func NewUserCPUSensor(resource, username string) Sensor {
+	return NewSensor(resource, UserCPUMeasurement(username))
+}
@@ -0,0 +1,179 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// invalidNameChars contains the characters which are not allowed in
+// a Grid Engine object name (see sge_types(1)) and therefore must not
+// appear in the name of a complex.
+const invalidNameChars = "\n\t\r /:'\\[]{}|()@%,\""
+
+// MaxResourceNameLength is the maximum length of a Grid Engine object
+// name like the name of a complex (MAX_VERIFY_STRING in the Grid
+// Engine sources). The execd rejects load values with longer names.
+const MaxResourceNameLength = 512
+
+// ValidateResourceName checks if the given name can be used as the
+// name of a Grid Engine complex.
+func ValidateResourceName(name string) error {
+	if name == "" {
+		return errors.New("resource name is empty")
+	}
+	if len(name) > MaxResourceNameLength {
+		return fmt.Errorf("resource name %.32q... is %d characters long, the maximum is %d",
+			name, len(name), MaxResourceNameLength)
+	}
+	if i := strings.IndexAny(name, invalidNameChars); i >= 0 {
+		return fmt.Errorf("resource name %q contains invalid character %q", name, name[i])
+	}
+	return nil
+}
+
+// exponentValue matches numbers in exponential notation like
+// "1.2e+06" as written by %g or strconv with the 'e' and 'g' formats.
+var exponentValue = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)[eE][+-]?\d+$`)
+
+// ValidateValue checks that a value is not a number Grid Engine can
+// not parse: the execd silently drops numbers in exponential notation
+// ("1.2e+06"). Numbers must be written with a '.' and without exponent,
+// like strconv.FormatFloat(v, 'f', -1, 64) does independent of the
+// locale. Other text is accepted since it can be the value of a STRING
+// complex, including text with commas like the GPU list "0,1" (see
+// ValidateTypedValue for numeric complexes).
+func ValidateValue(value string) error {
+	if exponentValue.MatchString(value) {
+		return fmt.Errorf("value %q uses exponential notation", value)
+	}
+	return nil
+}
+
+// ValidateTypedValue checks a value like ValidateValue and, when
+// complexType is one of the numeric complex types INT, DOUBLE and
+// MEMORY (see complex(5)), additionally rejects values containing a
+// comma, which the execd silently drops: numbers written in a locale
+// with a comma as decimal separator ("1,5") or with a thousands
+// separator ("1,024"). The type is compared case insensitive, values
+// of all other types are only checked by ValidateValue.
+func ValidateTypedValue(value, complexType string) error {
+	if err := ValidateValue(value); err != nil {
+		return err
+	}
+	if numericType(complexType) && strings.ContainsRune(value, ',') {
+		return fmt.Errorf("value %q of %s complex contains a comma", value, strings.ToUpper(complexType))
+	}
+	return nil
+}
+
+// numericType checks if complexType is the type of a numeric complex.
+func numericType(complexType string) bool {
+	switch strings.ToUpper(complexType) {
+	case "INT", "DOUBLE", "MEMORY":
+		return true
+	}
+	return false
+}
+
+// isInteger checks if value is an integer which fits into an int64 or
+// an uint64.
+func isInteger(value string) bool {
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return true
+	}
+	_, err := strconv.ParseUint(value, 10, 64)
+	return err == nil
+}
+
+// validateLine checks a single host:resource:value line of a load report.
+func validateLine(line string) error {
+	fields := strings.Split(line, ":")
+	if len(fields) != 3 {
+		return fmt.Errorf("%q does not match host:resource:value", line)
+	}
+	if fields[0] == "" {
+		return fmt.Errorf("%q has an empty host", line)
+	}
+	if strings.ContainsAny(fields[0], " \t\r") {
+		return fmt.Errorf("%q has whitespace in host", line)
+	}
+	if err := ValidateResourceName(fields[1]); err != nil {
+		return fmt.Errorf("%q: %s", line, err)
+	}
+	if fields[2] == "" {
+		return fmt.Errorf("%q has an empty value", line)
+	}
+	if strings.ContainsRune(fields[2], '\r') {
+		return fmt.Errorf("%q has a carriage return in value", line)
+	}
+	if err := ValidateValue(fields[2]); err != nil {
+		return fmt.Errorf("%q: %s", line, err)
+	}
+	return nil
+}
+
+// ValidateOutput reads the output of a load sensor (as written by Run)
+// and checks it against the rules of the Grid Engine load sensor
+// protocol: each report must be framed by a "begin" and an "end" line
+// and each line in between must be of the form host:resource:value
+// with a valid resource name, without additional colons and with a
+// value Grid Engine can parse (see ValidateValue). Lines may end with
+// "\n" or "\r\n" (see WithLineEnding). All violations found are
+// returned, an empty result means the output is valid.
+func ValidateOutput(r io.Reader) []error {
+	var errs []error
+	inReport := false
+	lineNumber := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNumber++
+		// the scanner removes the "\r" of CRLF line endings
+		line := scanner.Text()
+		switch {
+		case line == "begin":
+			if inReport {
+				errs = append(errs, fmt.Errorf("line %d: begin without end of previous report", lineNumber))
+			}
+			inReport = true
+		case line == "end":
+			if !inReport {
+				errs = append(errs, fmt.Errorf("line %d: end without begin", lineNumber))
+			}
+			inReport = false
+		case !inReport:
+			errs = append(errs, fmt.Errorf("line %d: %q outside of begin/end", lineNumber, line))
+		default:
+			if err := validateLine(line); err != nil {
+				errs = append(errs, fmt.Errorf("line %d: %s", lineNumber, err))
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, fmt.Errorf("line %d: %s", lineNumber+1, err))
+	}
+	if inReport {
+		errs = append(errs, errors.New("report is not terminated by end"))
+	}
+	return errs
+}
@@ -0,0 +1,144 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestValidateTypedValue(t *testing.T) {
+	tests := []struct {
+		value, complexType string
+		valid              bool
+	}{
+		{"1.5", "DOUBLE", true},
+		{"-0.25", "double", true},
+		{"1024", "MEMORY", true},
+		// written in locales with a decimal comma or a thousands separator
+		{"1,5", "DOUBLE", false},
+		{"-1,25", "double", false},
+		{"1.234,5", "DOUBLE", false},
+		{"1,024", "INT", false},
+		{"2,5G", "MEMORY", false},
+		{"1.2e+06", "DOUBLE", false},
+		{"1E6", "", false},
+		// text with commas is a valid STRING value
+		{"0,1", "STRING", true},
+		{"0,1", "RESTRING", true},
+		{"0,1", "", true},
+		{"a,b", "", true},
+	}
+	for _, test := range tests {
+		err := ValidateTypedValue(test.value, test.complexType)
+		if (err == nil) != test.valid {
+			t.Errorf("ValidateTypedValue(%q, %q): expected valid %v, got %v", test.value, test.complexType, test.valid, err)
+		}
+	}
+}
+
+func TestFormattedFloatsAreValid(t *testing.T) {
+	for _, v := range []float64{0, 1.5, -0.001, 1.2e6, 1e21, 123456789.125} {
+		for _, value := range []string{strconv.FormatFloat(v, 'f', -1, 64), fmt.Sprintf("%.3f", v)} {
+			if err := ValidateTypedValue(value, "DOUBLE"); err != nil {
+				t.Errorf("formatted value of %g is invalid: %s", v, err)
+			}
+		}
+	}
+}
+
+func TestCommaValueOfTypedSensor(t *testing.T) {
+	double := testSensor("load", func() (string, error) { return "1,5", nil })
+	double.Type = "DOUBLE"
+	gpus := testSensor("gpus", func() (string, error) { return "0,1", nil })
+	gpus.Type = "STRING"
+	ctx, err := CreateWithOptions([]Sensor{double, gpus}, WithLogOutput(&logRecorder{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report := runReport(t, ctx); report != "begin\nhost:gpus:0,1\nend\n" {
+		t.Errorf("unexpected report %q", report)
+	}
+}
+
+func TestCreateRejectsLongResourceName(t *testing.T) {
+	long := strings.Repeat("r", MaxResourceNameLength+1)
+	if _, err := Create([]Sensor{testSensor(long, func() (string, error) { return "1", nil })}); err == nil {
+		t.Error("Create accepted a resource name above MaxResourceNameLength")
+	}
+	if _, err := Create([]Sensor{testSensor("free space", func() (string, error) { return "1", nil })}); err == nil {
+		t.Error("Create accepted a resource name with whitespace")
+	}
+	dynamic := testSensor("", func() (string, error) { return "1", nil })
+	resolved := false
+	dynamic.ResourceNameFunction = func() (string, error) {
+		if !resolved {
+			resolved = true
+			return "", errors.New("not known yet")
+		}
+		return long, nil
+	}
+	logs := &logRecorder{}
+	ctx, err := CreateWithOptions([]Sensor{dynamic}, WithLogOutput(logs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report := runReport(t, ctx); report != "begin\nend\n" {
+		t.Errorf("the long resource name was reported: %q", report)
+	}
+	if n := logs.count("characters long, the maximum is"); n != 1 {
+		t.Errorf("expected the invalid name to be logged, got %q", logs.logs.String())
+	}
+}
+
+func TestValidateOutput(t *testing.T) {
+	tests := []struct {
+		output string
+		errors []string
+	}{
+		{"begin\nnode1:load:0.5\nend\n", nil},
+		{"begin\nend\n", nil},
+		{"", nil},
+		{"begin\r\nnode1:load:0.5\r\nend\r\n", nil},
+		// several hosts and reports
+		{"begin\nnode1:load:0.5\nnode2:load:1\nnode2:tmp_free:10G\nend\nbegin\nnode1:load:0.7\nend\n", nil},
+		{"node1:load:0.5\nend\n", []string{`line 1: "node1:load:0.5" outside of begin/end`, "line 2: end without begin"}},
+		{"begin\nnode1:load:0.5\n", []string{"report is not terminated by end"}},
+		{"begin\nbegin\nend\n", []string{"line 2: begin without end of previous report"}},
+		{"begin\nnode1:load\nnode1:load:1:2\n:load:1\nnode1:lo ad:1\nnode1:load:\nnode1:load:1e+06\nend\n", []string{
+			`line 2: "node1:load" does not match host:resource:value`,
+			`line 3: "node1:load:1:2" does not match host:resource:value`,
+			`line 4: ":load:1" has an empty host`,
+			`line 5: "node1:lo ad:1": resource name "lo ad" contains invalid character ' '`,
+			`line 6: "node1:load:" has an empty value`,
+			`line 7: "node1:load:1e+06": value "1e+06" uses exponential notation`,
+		}},
+		{"begin\r\nnode1:load:1\r\r\nend\r\n", []string{`line 2: "node1:load:1\r" has a carriage return in value`}},
+	}
+	for i, test := range tests {
+		var messages []string
+		for _, err := range ValidateOutput(strings.NewReader(test.output)) {
+			messages = append(messages, err.Error())
+		}
+		if strings.Join(messages, "\n") != strings.Join(test.errors, "\n") {
+			t.Errorf("test %d: expected the errors %q, got %q", i, test.errors, messages)
+		}
+	}
+}
@@ -0,0 +1,589 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// formatFloat formats a float value for the load report without
+// exponent and with the minimal number of digits required.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// ErrNotFinite is returned when a measurement results in NaN or an
+// infinite value, for example after a division by zero. Grid Engine
+// can not parse these values, so they are never reported.
+var ErrNotFinite = errors.New("value is not a finite number")
+
+// checkFinite returns an error wrapping ErrNotFinite when v is NaN or
+// infinite.
+func checkFinite(v float64) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Errorf("%w: %v", ErrNotFinite, v)
+	}
+	return nil
+}
+
+// notFiniteValue checks if a measured value is the text representation
+// of NaN or an infinite value as written by strconv or fmt.
+func notFiniteValue(value string) bool {
+	switch strings.ToLower(strings.TrimLeft(value, "+-")) {
+	case "nan", "inf", "infinity":
+		return true
+	}
+	return false
+}
+
+// Scale returns a measurement function which multiplies the result
+// of f by factor. A factor of 1.0/(1<<20) converts bytes to MiB. An
+// error wrapping ErrNotFinite is returned when the result is NaN or
+// infinite.
+func Scale(f func() (float64, error), factor float64) func() (string, error) {
+	return func() (string, error) {
+		v, err := f()
+		if err != nil {
+			return "", err
+		}
+		if err := checkFinite(v * factor); err != nil {
+			return "", err
+		}
+		return formatFloat(v * factor), nil
+	}
+}
+
+// ScaleInt returns a measurement function which multiplies the
+// integer result of f by factor and reports it as integer. The scaled
+// value is rounded to the nearest integer, halfway values are rounded
+// away from zero (2.5 becomes 3, -2.5 becomes -3). Factors which are
+// integers or the reciprocal of an integer (like 1.0/(1<<20)) are
+// applied with integer arithmetic, so that large values like byte
+// counts do not lose precision, other factors use float64. An error
+// wrapping ErrNotFinite is returned when the factor or the result is
+// NaN or infinite, an error is returned as well when the result does
+// not fit into an int64.
+func ScaleInt(f func() (int64, error), factor float64) func() (string, error) {
+	return func() (string, error) {
+		v, err := f()
+		if err != nil {
+			return "", err
+		}
+		if err := checkFinite(factor); err != nil {
+			return "", fmt.Errorf("invalid factor: %w", err)
+		}
+		if scaled, ok := scaleIntExact(v, factor); ok {
+			return strconv.FormatInt(scaled, 10), nil
+		}
+		scaled := math.Round(float64(v) * factor)
+		if err := checkFinite(scaled); err != nil {
+			return "", err
+		}
+		if scaled >= math.MaxInt64 || scaled < math.MinInt64 {
+			return "", fmt.Errorf("scaled value %v is out of the range of int64", scaled)
+		}
+		return strconv.FormatInt(int64(scaled), 10), nil
+	}
+}
+
+// scaleIntExact scales v with integer arithmetic when factor is an
+// integer or the reciprocal of an integer and the result does not
+// overflow.
+func scaleIntExact(v int64, factor float64) (int64, bool) {
+	const limit = 1 << 62
+	if factor == math.Trunc(factor) && math.Abs(factor) < limit {
+		m := int64(factor)
+		if m == 0 {
+			return 0, true
+		}
+		if r := v * m; r/m == v && !(v == math.MinInt64 && m == -1) {
+			return r, true
+		}
+		return 0, false
+	}
+	divisor := 1 / factor
+	if divisor == 0 || divisor != math.Trunc(divisor) || math.Abs(divisor) >= limit {
+		return 0, false
+	}
+	d := int64(divisor)
+	q, r := v/d, v%d
+	if r < 0 {
+		r = -r
+	}
+	if d < 0 {
+		d = -d
+	}
+	if 2*r >= d {
+		// round halfway values away from zero
+		if (v < 0) != (divisor < 0) {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q, true
+}
+
+// IntMeasurement converts a function returning an int64 into a
+// measurement function. The value is formatted exactly without a
+// conversion to float.
+func IntMeasurement(f func() (int64, error)) func() (string, error) {
+	return func() (string, error) {
+		v, err := f()
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(v, 10), nil
+	}
+}
+
+// FloatMeasurement converts a function returning a float64 into a
+// measurement function reporting the value with precision digits after
+// the decimal point, rounded like the values of a Sensor.Precision. A
+// negative precision uses the smallest number of digits necessary. An
+// error wrapping ErrNotFinite is returned when the value is NaN or
+// infinite.
+func FloatMeasurement(f func() (float64, error), precision int) func() (string, error) {
+	return func() (string, error) {
+		v, err := f()
+		if err != nil {
+			return "", err
+		}
+		if err := checkFinite(v); err != nil {
+			return "", err
+		}
+		return roundFloat(v, precision), nil
+	}
+}
+
+// Digits returns a pointer to n for Sensor.Precision.
+func Digits(n int) *int {
+	return &n
+}
+
+// formatPrecision formats a numeric value with the given precision and
+// returns other values unchanged.
+func formatPrecision(value string, precision int) string {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return value
+	}
+	return roundFloat(v, precision)
+}
+
+// roundFloat formats v with precision digits after the decimal point.
+// It rounds the shortest decimal representation of v (see formatFloat)
+// instead of its binary value, so that 1.005 becomes 1.01 like written
+// although the nearest float64 is slightly below 1.005. Halfway values
+// are rounded away from zero like in ScaleInt, which strconv does not
+// do (it rounds 0.125 to 0.12), and a value rounded to zero is
+// reported without sign.
+func roundFloat(v float64, precision int) string {
+	if precision < 0 {
+		return formatFloat(v)
+	}
+	integer, fraction, _ := strings.Cut(formatFloat(math.Abs(v)), ".")
+	if len(fraction) <= precision {
+		fraction += strings.Repeat("0", precision-len(fraction))
+	} else {
+		roundUp := fraction[precision] >= '5'
+		digits := []byte(integer + fraction[:precision])
+		for i := len(digits) - 1; roundUp && i >= 0; i-- {
+			if digits[i] == '9' {
+				digits[i] = '0'
+				continue
+			}
+			digits[i]++
+			roundUp = false
+		}
+		if roundUp {
+			digits = append([]byte{'1'}, digits...)
+		}
+		integer, fraction = string(digits[:len(digits)-precision]), string(digits[len(digits)-precision:])
+	}
+	result := integer
+	if precision > 0 {
+		result += "." + fraction
+	}
+	if v < 0 && strings.Trim(result, "0.") != "" {
+		result = "-" + result
+	}
+	return result
+}
+
+// Uint64Measurement converts a function returning an uint64, like a
+// byte count, into a measurement function. The value is formatted
+// exactly without a conversion to float, also beyond the range of
+// int64.
+func Uint64Measurement(f func() (uint64, error)) func() (string, error) {
+	return func() (string, error) {
+		v, err := f()
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatUint(v, 10), nil
+	}
+}
+
+// debouncer holds the state of a Debounce wrapper.
+type debouncer struct {
+	sync.Mutex
+	clock        Clock
+	f            func() (string, error)
+	stablePeriod time.Duration
+	initialized  bool
+	reported     string
+	pending      string
+	pendingSince time.Time
+}
+
+func (d *debouncer) measure() (string, error) {
+	v, err := d.f()
+	if err != nil {
+		return "", err
+	}
+	d.Lock()
+	defer d.Unlock()
+	now := d.clock.Now()
+	switch {
+	case !d.initialized:
+		d.initialized = true
+		d.reported = v
+	case v == d.reported:
+		d.pending = ""
+		d.pendingSince = time.Time{}
+	case v != d.pending || d.pendingSince.IsZero():
+		d.pending = v
+		d.pendingSince = now
+	case now.Sub(d.pendingSince) >= d.stablePeriod:
+		d.reported = v
+		d.pending = ""
+		d.pendingSince = time.Time{}
+	}
+	return d.reported, nil
+}
+
+// Debounce returns a measurement function which reports a new value
+// of f only after f returned it for at least stablePeriod. Until then
+// the previously reported value is repeated. This avoids flapping
+// complexes when a measurement toggles around a threshold. Errors of
+// f are returned unchanged and do not affect the state. The state is
+// kept in memory only: after a restart of the load sensor the first
+// value of f is reported immediately.
+func Debounce(f func() (string, error), stablePeriod time.Duration) func() (string, error) {
+	if stablePeriod <= 0 {
+		return f
+	}
+	d := &debouncer{clock: currentClock(), f: f, stablePeriod: stablePeriod}
+	return d.measure
+}
+
+// extremum returns a measurement function reporting the extreme value
+// of f seen so far, where better reports if a new value replaces the
+// current one.
+func extremum(f func() (float64, error), better func(v, current float64) bool) func() (string, error) {
+	var mutex sync.Mutex
+	var current float64
+	seen := false
+	return func() (string, error) {
+		v, err := f()
+		if err != nil {
+			return "", err
+		}
+		if err := checkFinite(v); err != nil {
+			return "", err
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		if !seen || better(v, current) {
+			current, seen = v, true
+		}
+		return formatFloat(current), nil
+	}
+}
+
+// Max returns a measurement function which reports the highest value
+// f returned since the measurement function was created (a high-water
+// mark). Errors of f, as well as NaN and infinite values (reported as
+// ErrNotFinite), are returned and do not affect the maximum. The
+// maximum is never reset, it is kept in memory only: restarting the
+// load sensor starts over with the next value of f. The returned
+// function is safe for concurrent use.
+func Max(f func() (float64, error)) func() (string, error) {
+	return extremum(f, func(v, current float64) bool { return v > current })
+}
+
+// Min returns a measurement function which reports the lowest value f
+// returned since the measurement function was created. It behaves
+// like Max otherwise.
+func Min(f func() (float64, error)) func() (string, error) {
+	return extremum(f, func(v, current float64) bool { return v < current })
+}
+
+// sampleWindow is a ring buffer with the last values of a measurement.
+type sampleWindow struct {
+	samples []float64
+	next    int
+}
+
+func newSampleWindow(size int) *sampleWindow {
+	return &sampleWindow{samples: make([]float64, 0, size)}
+}
+
+// add adds v to the window and replaces the oldest value when the
+// window is full.
+func (w *sampleWindow) add(v float64) {
+	if len(w.samples) < cap(w.samples) {
+		w.samples = append(w.samples, v)
+		return
+	}
+	w.samples[w.next] = v
+	w.next = (w.next + 1) % len(w.samples)
+}
+
+// StdDev returns a measurement function which reports the population
+// standard deviation of the last window values of f, for example to
+// detect a host whose load is erratic rather than high. The values are
+// kept in a ring buffer in memory. Until the window is filled the
+// standard deviation of the available values is reported; with only
+// one value nothing is reported (see ErrSkip) since its deviation is
+// not meaningful. Errors of f, as well as NaN and infinite values
+// (reported as ErrNotFinite), are returned and do not enter the
+// window. A window below 2 is 2. The returned function is safe for
+// concurrent use.
+func StdDev(f func() (float64, error), window int) func() (string, error) {
+	if window < 2 {
+		window = 2
+	}
+	var mutex sync.Mutex
+	w := newSampleWindow(window)
+	return func() (string, error) {
+		v, err := f()
+		if err != nil {
+			return "", err
+		}
+		if err := checkFinite(v); err != nil {
+			return "", err
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		w.add(v)
+		if len(w.samples) < 2 {
+			return "", ErrSkip
+		}
+		var mean float64
+		for _, sample := range w.samples {
+			mean += sample
+		}
+		mean /= float64(len(w.samples))
+		var variance float64
+		for _, sample := range w.samples {
+			variance += (sample - mean) * (sample - mean)
+		}
+		return formatFloat(math.Sqrt(variance / float64(len(w.samples)))), nil
+	}
+}
+
+// MaxPercentileWindow is the largest window of Percentile. Larger
+// windows are reduced to it.
+const MaxPercentileWindow = 10000
+
+// Percentile returns a measurement function which reports the pth
+// percentile (0 to 100, like 95 for p95) of the last window values of
+// f with the nearest-rank method: the reported value is the smallest
+// sample such that at least p percent of the samples are less than or
+// equal to it, so it is always one of the measured values and the
+// 100th percentile is the maximum. The values are kept in a ring
+// buffer in memory and sorted for every call, which costs
+// O(window log window) per load report and is the reason for
+// MaxPercentileWindow. Until the window is filled the percentile of
+// the available values is reported. Errors of f, as well as NaN and
+// infinite values (reported as ErrNotFinite), are returned and do not
+// enter the window. A window below 1 is 1. An error is returned when p
+// is not between 0 and 100. The returned function is safe for concurrent
+// use.
+func Percentile(f func() (float64, error), window int, p float64) func() (string, error) {
+	if window < 1 {
+		window = 1
+	}
+	if window > MaxPercentileWindow {
+		window = MaxPercentileWindow
+	}
+	var mutex sync.Mutex
+	w := newSampleWindow(window)
+	return func() (string, error) {
+		if !(p >= 0 && p <= 100) {
+			return "", fmt.Errorf("percentile %v is not between 0 and 100", p)
+		}
+		v, err := f()
+		if err != nil {
+			return "", err
+		}
+		if err := checkFinite(v); err != nil {
+			return "", err
+		}
+		mutex.Lock()
+		w.add(v)
+		sorted := append([]float64(nil), w.samples...)
+		mutex.Unlock()
+		sort.Float64s(sorted)
+		rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+		if rank < 1 {
+			rank = 1
+		}
+		return formatFloat(sorted[rank-1]), nil
+	}
+}
+
+// combine returns a measurement function reporting op applied to the
+// results of a and b.
+func combine(a, b func() (float64, error), op func(a, b float64) (float64, error)) func() (string, error) {
+	return func() (string, error) {
+		va, err := a()
+		if err != nil {
+			return "", err
+		}
+		vb, err := b()
+		if err != nil {
+			return "", err
+		}
+		v, err := op(va, vb)
+		if err != nil {
+			return "", err
+		}
+		if err := checkFinite(v); err != nil {
+			return "", err
+		}
+		return formatFloat(v), nil
+	}
+}
+
+// Difference creates a sensor for the local host reporting a minus b
+// as resource, for example the free space derived from a total and a
+// used measurement. When a or b fails its error is returned and no
+// value is reported in that load report.
+func Difference(resource string, a, b func() (float64, error)) Sensor {
+	return NewSensor(resource, combine(a, b, func(a, b float64) (float64, error) {
+		return a - b, nil
+	}))
+}
+
+// Ratio creates a sensor for the local host reporting a divided by b
+// as resource. Errors of a and b are handled like in Difference. When
+// b is 0 an error wrapping ErrNotFinite is returned instead of an
+// infinite value, so no value is reported in that load report.
+func Ratio(resource string, a, b func() (float64, error)) Sensor {
+	return NewSensor(resource, combine(a, b, func(a, b float64) (float64, error) {
+		if b == 0 {
+			return 0, fmt.Errorf("%w: division of %v by zero", ErrNotFinite, a)
+		}
+		return a / b, nil
+	}))
+}
+
+// WeightedTerm is a term of WeightedScore: a source of values and its
+// weight.
+type WeightedTerm struct {
+	Source func() (float64, error)
+	Weight float64
+	// ZeroOnError counts the term as 0 when its Source fails instead of
+	// failing the score, so the score is still reported while one
+	// source is temporarily not available.
+	ZeroOnError bool
+}
+
+// WeightedScore creates a sensor for the local host reporting the
+// weighted mean of the values of the terms as resource, for example a
+// node pressure score combining the CPU utilization, the memory usage
+// and the I/O wait in percent: the sum of each value multiplied by its
+// weight, divided by the sum of the weights, so that terms in the same
+// range (like 0 to 100) result in a score in that range. By default a
+// failing term fails the score and no value is reported in that load
+// report, with ZeroOnError the term counts as 0. An error wrapping
+// ErrNotFinite is returned when the weights sum up to 0 or the score is
+// not finite. The score is reported with the minimal number of digits,
+// set the Precision of the returned sensor to round it.
+func WeightedScore(resource string, terms []WeightedTerm) Sensor {
+	terms = append([]WeightedTerm(nil), terms...)
+	return NewSensor(resource, func() (string, error) {
+		var sum, weights float64
+		for i, term := range terms {
+			weights += term.Weight
+			v, err := term.Source()
+			if err != nil && term.ZeroOnError {
+				continue
+			}
+			if err != nil {
+				return "", fmt.Errorf("term %d: %w", i, err)
+			}
+			sum += term.Weight * v
+		}
+		if weights == 0 {
+			return "", fmt.Errorf("%w: weights sum up to zero", ErrNotFinite)
+		}
+		score := sum / weights
+		if err := checkFinite(score); err != nil {
+			return "", err
+		}
+		return formatFloat(score), nil
+	})
+}
+
+// lockedCall is a measurement request to the thread of LockedThread.
+type lockedCall struct {
+	value string
+	err   error
+	done  chan struct{}
+}
+
+// LockedThread returns a measurement function which executes f on a
+// dedicated goroutine locked to its own OS thread (see
+// runtime.LockOSThread), for example for cgo or ioctl based hardware
+// measurements which keep state per thread. All calls of the returned
+// function are executed one after another on the same thread, which
+// is started with the first call and kept for the lifetime of the
+// process. The caller, like a worker of WithParallelism, waits for the
+// result. A running measurement can not be interrupted: when f hangs
+// all following calls wait as well, and cancelling a context (see
+// FailFast) does not stop it.
+func LockedThread(f func() (string, error)) func() (string, error) {
+	var once sync.Once
+	calls := make(chan *lockedCall)
+	return func() (string, error) {
+		once.Do(func() {
+			go func() {
+				runtime.LockOSThread()
+				for call := range calls {
+					call.value, call.err = f()
+					close(call.done)
+				}
+			}()
+		})
+		call := &lockedCall{done: make(chan struct{})}
+		calls <- call
+		<-call.done
+		return call.value, call.err
+	}
+}
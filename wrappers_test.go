@@ -0,0 +1,276 @@
+/*
+   Copyright 2016 Daniel Gruber, Univa
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadsensor
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFloatMeasurementRounding(t *testing.T) {
+	tests := []struct {
+		v         float64
+		precision int
+		expected  string
+	}{
+		{0.125, 2, "0.13"},
+		{-0.125, 2, "-0.13"},
+		{0.124999, 2, "0.12"},
+		{2.5, 0, "3"},
+		{-2.5, 0, "-3"},
+		{0.5, 0, "1"},
+		{0.49999999999999994, 0, "0"},
+		{1.005, 2, "1.01"},
+		{2.675, 2, "2.68"},
+		{1.45, 1, "1.5"},
+		{9.995, 2, "10.00"},
+		{99.5, 0, "100"},
+		{-0.004, 2, "0.00"},
+		{-0.005, 2, "-0.01"},
+		{1.5, 3, "1.500"},
+		{0, 2, "0.00"},
+		{math.Copysign(0, -1), 1, "0.0"},
+		{1e-7, 6, "0.000000"},
+		{5e-7, 6, "0.000001"},
+		{1.2e6, 0, "1200000"},
+		{123.456, -1, "123.456"},
+	}
+	for _, test := range tests {
+		value, err := FloatMeasurement(func() (float64, error) { return test.v, nil }, test.precision)()
+		if err != nil {
+			t.Errorf("FloatMeasurement(%v, %d): %s", test.v, test.precision, err)
+			continue
+		}
+		if value != test.expected {
+			t.Errorf("FloatMeasurement(%v, %d): expected %q, got %q", test.v, test.precision, test.expected, value)
+		}
+	}
+}
+
+func TestFloatMeasurementNotFinite(t *testing.T) {
+	for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := FloatMeasurement(func() (float64, error) { return v, nil }, 2)(); !errors.Is(err, ErrNotFinite) {
+			t.Errorf("FloatMeasurement(%v): expected ErrNotFinite, got %v", v, err)
+		}
+	}
+}
+
+func TestScaleIntNotFiniteFactor(t *testing.T) {
+	for _, factor := range []float64{math.Inf(1), math.Inf(-1), math.NaN()} {
+		if _, err := ScaleInt(func() (int64, error) { return 5, nil }, factor)(); !errors.Is(err, ErrNotFinite) {
+			t.Errorf("ScaleInt(%v): expected ErrNotFinite, got %v", factor, err)
+		}
+	}
+	if _, ok := scaleIntExact(5, math.Inf(1)); ok {
+		t.Error("scaleIntExact accepted an infinite factor")
+	}
+}
+
+func TestSensorPrecision(t *testing.T) {
+	load := testSensor("load", func() (string, error) { return "0.125", nil })
+	load.Precision = Digits(2)
+	name := testSensor("name", func() (string, error) { return "node1", nil })
+	name.Precision = Digits(2)
+	ctx, err := CreateWithOptions([]Sensor{load, name},
+		WithValueFormatter(func(string) string { return "formatted" }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report := runReport(t, ctx); report != "begin\nhost:load:0.13\nhost:name:node1\nend\n" {
+		t.Errorf("unexpected report %q", report)
+	}
+}
+
+func TestLargeIntegersAreExact(t *testing.T) {
+	tests := []struct {
+		f        func() (string, error)
+		expected string
+	}{
+		{Uint64Measurement(func() (uint64, error) { return math.MaxUint64, nil }), "18446744073709551615"},
+		{Uint64Measurement(func() (uint64, error) { return 1<<63 + 1, nil }), "9223372036854775809"},
+		{IntMeasurement(func() (int64, error) { return math.MaxInt64, nil }), "9223372036854775807"},
+		{IntMeasurement(func() (int64, error) { return math.MinInt64, nil }), "-9223372036854775808"},
+		{ScaleInt(func() (int64, error) { return math.MaxInt64, nil }, 1), "9223372036854775807"},
+		{ScaleInt(func() (int64, error) { return math.MaxInt64, nil }, 1.0/1024), "9007199254740992"},
+		{ScaleInt(func() (int64, error) { return 1<<60 + 1, nil }, 2), "2305843009213693954"},
+		{ScaleInt(func() (int64, error) { return -3, nil }, 0.5), "-2"},
+	}
+	for i, test := range tests {
+		value, err := test.f()
+		if err != nil {
+			t.Errorf("test %d: %s", i, err)
+			continue
+		}
+		if value != test.expected {
+			t.Errorf("test %d: expected %s, got %s", i, test.expected, value)
+		}
+	}
+	if _, err := ScaleInt(func() (int64, error) { return math.MaxInt64, nil }, 2)(); err == nil {
+		t.Error("expected an error for an overflowing ScaleInt")
+	}
+}
+
+func TestIntSensorMaxUint64(t *testing.T) {
+	free := testSensor("free", Uint64Measurement(func() (uint64, error) { return math.MaxUint64, nil }))
+	free.Type = "INT"
+	fraction := testSensor("fraction", func() (string, error) { return "1.5", nil })
+	fraction.Type = "INT"
+	ctx, err := CreateWithOptions([]Sensor{free, fraction}, WithLogOutput(&logRecorder{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report := runReport(t, ctx); report != "begin\nhost:free:18446744073709551615\nend\n" {
+		t.Errorf("unexpected report %q", report)
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	SetDefaultClock(clock)
+	t.Cleanup(func() { SetDefaultClock(nil) })
+	var value string
+	var failure error
+	measure := Debounce(func() (string, error) { return value, failure }, time.Minute)
+	steps := []struct {
+		advance  time.Duration
+		value    string
+		reported string
+	}{
+		{0, "0", "0"}, // the first value is reported immediately
+		{10 * time.Second, "1", "0"},
+		{30 * time.Second, "1", "0"},
+		{30 * time.Second, "1", "1"}, // stable for a minute
+		{10 * time.Second, "0", "1"},
+		{10 * time.Second, "1", "1"}, // flapped back, the pending 0 is dropped
+		{10 * time.Second, "0", "1"},
+		{50 * time.Second, "0", "1"},
+		{10 * time.Second, "2", "1"}, // a different pending value starts over
+		{time.Minute, "2", "2"},
+	}
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		value = step.value
+		if reported, err := measure(); err != nil || reported != step.reported {
+			t.Errorf("step %d: expected %q, got %q, %v", i, step.reported, reported, err)
+		}
+		if i == 6 {
+			failure = errors.New("broken")
+			if _, err := measure(); err == nil {
+				t.Error("the error of f was not returned")
+			}
+			failure = nil
+		}
+	}
+}
+
+func TestDebounceWithoutPeriod(t *testing.T) {
+	value := "1"
+	measure := Debounce(func() (string, error) { return value, nil }, 0)
+	measure()
+	value = "2"
+	if reported, _ := measure(); reported != "2" {
+		t.Errorf("expected the value to be reported unchanged, got %q", reported)
+	}
+}
+
+// sequence returns a measurement function returning the given values
+// one after the other.
+func sequence(values ...float64) func() (float64, error) {
+	i := 0
+	return func() (float64, error) {
+		v := values[i]
+		i++
+		return v, nil
+	}
+}
+
+func TestStdDev(t *testing.T) {
+	measure := StdDev(sequence(2, 4, 4, 4, math.NaN(), 10), 3)
+	if _, err := measure(); !errors.Is(err, ErrSkip) {
+		t.Errorf("expected ErrSkip for a single value, got %v", err)
+	}
+	for i, expected := range []float64{1, math.Sqrt(8.0 / 9), 0, math.NaN(), math.Sqrt(8)} {
+		value, err := measure()
+		if math.IsNaN(expected) {
+			if !errors.Is(err, ErrNotFinite) {
+				t.Errorf("value %d: expected ErrNotFinite, got %q, %v", i, value, err)
+			}
+			continue
+		}
+		v, errParse := strconv.ParseFloat(value, 64)
+		if err != nil || errParse != nil || math.Abs(v-expected) > 1e-12 {
+			t.Errorf("value %d: expected %v, got %q, %v", i, expected, value, err)
+		}
+	}
+}
+
+func TestStdDevMinimumWindow(t *testing.T) {
+	measure := StdDev(sequence(1, 3, 7), 0)
+	measure()
+	for i, expected := range []string{"1", "2"} {
+		if value, err := measure(); err != nil || value != expected {
+			t.Errorf("value %d: expected %s, got %q, %v", i, expected, value, err)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	ten := []float64{7, 3, 10, 1, 9, 2, 8, 4, 6, 5}
+	tests := []struct {
+		values   []float64
+		window   int
+		p        float64
+		expected string
+	}{
+		{ten, 10, 50, "5"},
+		{ten, 10, 95, "10"},
+		{ten, 10, 90, "9"},
+		{ten, 10, 91, "10"},
+		{ten, 10, 0, "1"},
+		{ten, 10, 100, "10"},
+		{ten, 10, 10, "1"},
+		{ten, 10, 11, "2"},
+		// the oldest values leave the window
+		{append(ten, 11, 12), 10, 100, "12"},
+		{append(ten, 11, 12), 10, 50, "6"},
+		{append(ten, 0.5), 10, 95, "10"},
+		// a partially filled window
+		{[]float64{3, 1, 2}, 10, 50, "2"},
+		{[]float64{4.25}, 10, 99, "4.25"},
+		{[]float64{4, 8}, 0, 50, "8"},
+	}
+	for i, test := range tests {
+		measure := Percentile(sequence(test.values...), test.window, test.p)
+		var value string
+		var err error
+		for range test.values {
+			value, err = measure()
+		}
+		if err != nil || value != test.expected {
+			t.Errorf("test %d: expected %s, got %q, %v", i, test.expected, value, err)
+		}
+	}
+	if _, err := Percentile(sequence(1), 10, 101)(); err == nil {
+		t.Error("no error for a percentile above 100")
+	}
+	if _, err := Percentile(sequence(math.Inf(1)), 10, 50)(); !errors.Is(err, ErrNotFinite) {
+		t.Errorf("expected ErrNotFinite, got %v", err)
+	}
+}